@@ -0,0 +1,317 @@
+package xorm
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"math/rand"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/go-xorm/core"
+)
+
+// CacheInvalidation is a change of an engine's cache, which should also be
+// applied by the other engines sharing the same database
+type CacheInvalidation struct {
+	Table string
+	// Id is the cache id of a bean to delete, empty if no bean is deleted
+	Id string
+	// AllBeans clears all the cached beans of the table
+	AllBeans bool
+}
+
+// CacheBroadcaster publishes the cache invalidations of an engine to the
+// other engines, which apply them by Engine.ApplyCacheInvalidation
+type CacheBroadcaster interface {
+	Broadcast(invalidations []CacheInvalidation) error
+}
+
+// SetCacheBroadcaster set the broadcaster called when a session clears the
+// cache after insert, update or delete. In a transaction, the invalidations
+// are broadcasted after commit.
+func (engine *Engine) SetCacheBroadcaster(broadcaster CacheBroadcaster) {
+	engine.broadcasterMutex.Lock()
+	defer engine.broadcasterMutex.Unlock()
+	engine.cacheBroadcaster = broadcaster
+}
+
+func (engine *Engine) getCacheBroadcaster() CacheBroadcaster {
+	engine.broadcasterMutex.RLock()
+	defer engine.broadcasterMutex.RUnlock()
+	return engine.cacheBroadcaster
+}
+
+// ApplyCacheInvalidation applies an invalidation received from another
+// engine to the local cachers, it will not be broadcasted again.
+func (engine *Engine) ApplyCacheInvalidation(invalidation CacheInvalidation) {
+	engine.clearDependents(invalidation.Table)
+	for _, cacher := range engine.cachersOf(invalidation.Table) {
+		if invalidation.AllBeans {
+			cacher.ClearBeans(invalidation.Table)
+		} else if invalidation.Id != "" {
+			cacher.DelBean(invalidation.Table, invalidation.Id)
+		}
+		cacher.ClearIds(invalidation.Table)
+	}
+}
+
+// cachersOf returns the distinct cachers of the mapped tables named tableName
+func (engine *Engine) cachersOf(tableName string) []core.Cacher {
+	engine.mutex.RLock()
+	defer engine.mutex.RUnlock()
+	cachers := make([]core.Cacher, 0)
+	for _, table := range engine.Tables {
+		if table.Name != tableName || table.Cacher == nil {
+			continue
+		}
+		var has bool
+		for _, cacher := range cachers {
+			if cacher == table.Cacher {
+				has = true
+				break
+			}
+		}
+		if !has {
+			cachers = append(cachers, table.Cacher)
+		}
+	}
+	return cachers
+}
+
+// broadcastInvalidation publishes the invalidations of a statement together
+// now, or after the transaction committed
+func (session *Session) broadcastInvalidation(invalidations ...CacheInvalidation) {
+	broadcaster := session.Engine.getCacheBroadcaster()
+	if broadcaster == nil || len(invalidations) == 0 {
+		return
+	}
+	if !session.IsAutoCommit {
+		session.invalidations = append(session.invalidations, invalidations...)
+		return
+	}
+	if err := broadcaster.Broadcast(invalidations); err != nil {
+		session.Engine.LogError("[xorm:broadcast]", err)
+	}
+}
+
+func (session *Session) flushInvalidations() {
+	if len(session.invalidations) == 0 {
+		return
+	}
+	if broadcaster := session.Engine.getCacheBroadcaster(); broadcaster != nil {
+		if err := broadcaster.Broadcast(session.invalidations); err != nil {
+			session.Engine.LogError("[xorm:broadcast]", err)
+		}
+	}
+	session.invalidations = nil
+}
+
+// cacheInvalidationLog is a row of the invalidation log table used by
+// DBCacheBroadcaster
+type cacheInvalidationLog struct {
+	Id       int64  `xorm:"pk autoincr nocache"`
+	Node     string `xorm:"varchar(64) notnull"`
+	Tbl      string `xorm:"varchar(255) notnull"`
+	BeanId   string `xorm:"varchar(1024)"`
+	AllBeans bool
+	Created  time.Time `xorm:"created index"`
+}
+
+func (cacheInvalidationLog) TableName() string {
+	return "xorm_cache_invalidation"
+}
+
+const (
+	// default max age of the rows in the invalidation log table
+	DEFAULT_INVALIDATION_RETENTION = time.Hour
+	// default time a skipped id of the log is polled again
+	DEFAULT_INVALIDATION_GAP_TIMEOUT = time.Minute
+
+	// max skipped ids kept, the older gaps are given up over it
+	maxInvalidationGaps = 10000
+	pollBatchSize       = 1000
+)
+
+// DBCacheBroadcaster uses a table of the database as the invalidation log,
+// every engine appends its invalidations to it and polls the others'.
+type DBCacheBroadcaster struct {
+	engine   *Engine
+	node     string
+	interval time.Duration
+	lastId   int64
+	// the ids below lastId not read yet, with the time they were skipped
+	gaps     map[int64]time.Time
+	ctx      context.Context
+	cancel   context.CancelFunc
+	stopOnce sync.Once
+
+	// Retention is the max age of the log rows, the older ones are deleted
+	Retention time.Duration
+	// GapTimeout is how long an id skipped by the poll is polled again.
+	// The writers could commit their rows out of id order, so a lower id
+	// could be visible after a higher one, or never for a rollback.
+	GapTimeout time.Duration
+}
+
+// NewDBCacheBroadcaster creates the invalidation log table if not exists, set
+// the broadcaster to engine and starts polling the log every interval
+func NewDBCacheBroadcaster(engine *Engine, interval time.Duration) (*DBCacheBroadcaster, error) {
+	if err := engine.Sync2(new(cacheInvalidationLog)); err != nil {
+		return nil, err
+	}
+
+	hostname, _ := os.Hostname()
+	b := &DBCacheBroadcaster{
+		engine:     engine,
+		node:       fmt.Sprintf("%v-%v-%v", hostname, os.Getpid(), rand.Int63()),
+		interval:   interval,
+		gaps:       make(map[int64]time.Time),
+		Retention:  DEFAULT_INVALIDATION_RETENTION,
+		GapTimeout: DEFAULT_INVALIDATION_GAP_TIMEOUT,
+	}
+	b.ctx, b.cancel = context.WithCancel(context.Background())
+	if len(b.node) > 64 {
+		b.node = b.node[len(b.node)-64:]
+	}
+
+	// only the invalidations after started are applied
+	var last cacheInvalidationLog
+	has, err := engine.NoCache().Desc("id").Get(&last)
+	if err != nil {
+		return nil, err
+	}
+	if has {
+		b.lastId = last.Id
+	}
+
+	engine.SetCacheBroadcaster(b)
+	go b.run()
+	return b, nil
+}
+
+func (b *DBCacheBroadcaster) Broadcast(invalidations []CacheInvalidation) error {
+	logs := make([]*cacheInvalidationLog, 0, len(invalidations))
+	for _, invalidation := range invalidations {
+		logs = append(logs, &cacheInvalidationLog{
+			Node: b.node,
+			Tbl:  invalidation.Table,
+			// the cache id is a gob encoded binary string
+			BeanId:   base64.StdEncoding.EncodeToString([]byte(invalidation.Id)),
+			AllBeans: invalidation.AllBeans,
+		})
+	}
+	_, err := b.engine.NoCache().Insert(&logs)
+	return err
+}
+
+func (b *DBCacheBroadcaster) run() {
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+	lastCleanup := time.Now()
+	for {
+		select {
+		case <-b.ctx.Done():
+			return
+		case <-ticker.C:
+			if err := b.poll(); err != nil {
+				b.engine.LogError("[xorm:broadcast] poll", err)
+			}
+			if b.Retention > 0 && time.Now().Sub(lastCleanup) > b.Retention/10 {
+				lastCleanup = time.Now()
+				_, err := b.engine.NoCache().Where("created < ?", time.Now().Add(-b.Retention)).
+					Delete(new(cacheInvalidationLog))
+				if err != nil {
+					b.engine.LogError("[xorm:broadcast] cleanup", err)
+				}
+			}
+		}
+	}
+}
+
+// poll applies the invalidations of the other engines since the last poll,
+// and the ones skipped by the previous polls which are committed since
+func (b *DBCacheBroadcaster) poll() error {
+	if err := b.pollGaps(); err != nil {
+		return err
+	}
+	for {
+		logs := make([]cacheInvalidationLog, 0)
+		err := b.engine.NoCache().Where("id > ?", b.lastId).Asc("id").Limit(pollBatchSize).Find(&logs)
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		for _, log := range logs {
+			for id := b.lastId + 1; id < log.Id && len(b.gaps) < maxInvalidationGaps; id++ {
+				b.gaps[id] = now
+			}
+			b.lastId = log.Id
+			b.apply(&log)
+		}
+		if len(logs) < pollBatchSize {
+			return nil
+		}
+	}
+}
+
+// pollGaps reads the skipped ids again, the ones skipped for GapTimeout are
+// given up
+func (b *DBCacheBroadcaster) pollGaps() error {
+	ids := make([]interface{}, 0, len(b.gaps))
+	for id, skipped := range b.gaps {
+		if time.Since(skipped) > b.GapTimeout {
+			delete(b.gaps, id)
+			continue
+		}
+		ids = append(ids, id)
+	}
+
+	for len(ids) > 0 {
+		batch := ids
+		if len(batch) > pollBatchSize {
+			batch = batch[:pollBatchSize]
+		}
+		ids = ids[len(batch):]
+
+		logs := make([]cacheInvalidationLog, 0)
+		if err := b.engine.NoCache().In("id", batch...).Find(&logs); err != nil {
+			return err
+		}
+		for _, log := range logs {
+			delete(b.gaps, log.Id)
+			b.apply(&log)
+		}
+	}
+	return nil
+}
+
+// apply applies an invalidation of the log written by another engine
+func (b *DBCacheBroadcaster) apply(log *cacheInvalidationLog) {
+	if log.Node == b.node {
+		return
+	}
+	id, err := base64.StdEncoding.DecodeString(log.BeanId)
+	if err != nil {
+		b.engine.LogError("[xorm:broadcast]", err)
+		return
+	}
+	b.engine.ApplyCacheInvalidation(CacheInvalidation{
+		Table:    log.Tbl,
+		Id:       string(id),
+		AllBeans: log.AllBeans,
+	})
+}
+
+// Close stops polling and unset the broadcaster of the engine
+func (b *DBCacheBroadcaster) Close() {
+	b.stopOnce.Do(func() {
+		b.cancel()
+		b.engine.broadcasterMutex.Lock()
+		if b.engine.cacheBroadcaster == CacheBroadcaster(b) {
+			b.engine.cacheBroadcaster = nil
+		}
+		b.engine.broadcasterMutex.Unlock()
+	})
+}
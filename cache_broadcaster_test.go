@@ -0,0 +1,80 @@
+package xorm
+
+import (
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+)
+
+type broadcastBean struct {
+	Id   int64
+	Name string
+}
+
+// testBroadcaster records the invalidations of every Broadcast call
+type testBroadcaster struct {
+	calls [][]CacheInvalidation
+}
+
+func (b *testBroadcaster) Broadcast(invalidations []CacheInvalidation) error {
+	b.calls = append(b.calls, invalidations)
+	return nil
+}
+
+func TestDeleteBroadcast(t *testing.T) {
+	var tests = []struct {
+		name  string
+		err   error
+		calls int
+	}{
+		{"deleted", nil, 1},
+		{"failed", errors.New("delete failed"), 0},
+	}
+
+	for _, test := range tests {
+		engine, db := newTestEngine(t)
+		engine.MapCacher(&broadcastBean{}, NewLRUCacher(NewMemoryStore(), 100))
+		broadcaster := &testBroadcaster{}
+		engine.SetCacheBroadcaster(broadcaster)
+		db.rows = func(query string, args []driver.Value) ([]string, [][]driver.Value) {
+			return []string{"id"}, [][]driver.Value{{int64(1)}, {int64(2)}}
+		}
+		if test.err != nil {
+			db.setErr("DELETE", test.err)
+		}
+
+		_, err := engine.Where("name = ?", "a").Delete(&broadcastBean{})
+		if !errors.Is(err, test.err) {
+			t.Errorf("%v: error %v, want %v", test.name, err, test.err)
+		}
+		if len(broadcaster.calls) != test.calls {
+			t.Fatalf("%v: %d broadcasts, want %d", test.name, len(broadcaster.calls), test.calls)
+		}
+		if test.calls == 0 {
+			continue
+		}
+		// the two deleted beans and the table's ids
+		if invalidations := broadcaster.calls[0]; len(invalidations) != 3 {
+			t.Errorf("%v: broadcasted %v, want 3 invalidations", test.name, invalidations)
+		}
+	}
+}
+
+func TestDBCacheBroadcasterBatch(t *testing.T) {
+	engine, db := newTestEngine(t)
+	b := &DBCacheBroadcaster{engine: engine, node: "node"}
+	err := b.Broadcast([]CacheInvalidation{
+		{Table: "user", Id: "1"},
+		{Table: "user", Id: "2"},
+		{Table: "user"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sqls := db.executed()
+	if len(sqls) != 1 || !strings.HasPrefix(sqls[0], "INSERT INTO `xorm_cache_invalidation`") {
+		t.Errorf("executed %q, want one insert", sqls)
+	}
+}
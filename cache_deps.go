@@ -0,0 +1,85 @@
+package xorm
+
+import (
+	"sync"
+
+	"github.com/go-xorm/core"
+)
+
+// DepsCacher is implemented by the cachers which could record the joined
+// tables an id list is read from, so the list is cleared when any of them is
+// written. The ids of joined queries are only cached by such cachers.
+type DepsCacher interface {
+	PutIdsDeps(tableName, sql string, deps []string)
+	ClearDepIds(depName string)
+}
+
+var _ DepsCacher = &LRUCacher{}
+
+// cacheDeps keeps the cachers holding id lists read from a joined table
+type cacheDeps struct {
+	mutex   sync.RWMutex
+	cachers map[string][]DepsCacher
+}
+
+func (d *cacheDeps) add(deps []string, cacher DepsCacher) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if d.cachers == nil {
+		d.cachers = make(map[string][]DepsCacher)
+	}
+	for _, dep := range deps {
+		var has bool
+		for _, c := range d.cachers[dep] {
+			if c == cacher {
+				has = true
+				break
+			}
+		}
+		if !has {
+			d.cachers[dep] = append(d.cachers[dep], cacher)
+		}
+	}
+}
+
+func (d *cacheDeps) clear(depName string) {
+	d.mutex.RLock()
+	cachers := d.cachers[depName]
+	d.mutex.RUnlock()
+	for _, cacher := range cachers {
+		cacher.ClearDepIds(depName)
+	}
+}
+
+// clearDependents drops the cached query results and the joined id lists of
+// the other tables depending on tableName
+func (engine *Engine) clearDependents(tableName string) {
+	engine.queryCache.invalidate(tableName)
+	engine.joinDeps.clear(tableName)
+}
+
+// joinCacheable reports if the ids of the statement could be cached by
+// cacher, a joined query needs a DepsCacher
+func (statement *Statement) joinCacheable(cacher core.Cacher) bool {
+	if len(statement.joinTables) == 0 {
+		return true
+	}
+	_, ok := cacher.(DepsCacher)
+	return ok
+}
+
+// putIdsDeps records the joined tables of the statement as the deps of the
+// ids cached for sql
+func (session *Session) putIdsDeps(cacher core.Cacher, tableName, sql string, args interface{}) {
+	if len(session.Statement.joinTables) == 0 {
+		return
+	}
+	depsCacher, ok := cacher.(DepsCacher)
+	if !ok {
+		return
+	}
+	deps := make([]string, len(session.Statement.joinTables))
+	copy(deps, session.Statement.joinTables)
+	session.Engine.joinDeps.add(deps, depsCacher)
+	depsCacher.PutIdsDeps(tableName, core.GenSqlKey(sql, args), deps)
+}
@@ -0,0 +1,119 @@
+package xorm
+
+import (
+	"errors"
+	"sync"
+)
+
+// errWarmCacheFull stops iterating a table when its cacher is full
+var errWarmCacheFull = errors.New("cache is full")
+
+// WarmCacheOptions controls how Engine.WarmCacheWith loads the tables
+type WarmCacheOptions struct {
+	// Concurrency is the max tables loaded at the same time, 1 if <= 0
+	Concurrency int
+	// ProgressEvery, if > 0, reports the progress of a table after every
+	// ProgressEvery beans cached
+	ProgressEvery int
+	// Progress is called with the count of beans cached of a table, done is
+	// true when the table is finished
+	Progress func(tableName string, cached int, done bool)
+}
+
+// WarmCache loads all the rows of the tables of beans into their cachers,
+// see WarmCacheWith
+func (engine *Engine) WarmCache(beans ...interface{}) error {
+	return engine.WarmCacheWith(WarmCacheOptions{}, beans...)
+}
+
+// WarmCacheWith loads all the rows of the tables of beans into their cachers
+// by Iterate, a table stops loading when its LRUCacher has MaxElementSize
+// beans. Tables without cacher or primary key are skipped. The first error
+// is returned after all the tables are finished.
+func (engine *Engine) WarmCacheWith(options WarmCacheOptions, beans ...interface{}) error {
+	concurrency := options.Concurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+	var firstErr error
+	sem := make(chan struct{}, concurrency)
+	for _, bean := range beans {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(bean interface{}) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			session := engine.NewSession()
+			defer session.Close()
+			if err := session.warmCache(bean, options); err != nil {
+				mutex.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				mutex.Unlock()
+			}
+		}(bean)
+	}
+	wg.Wait()
+	return firstErr
+}
+
+// WarmCache loads the rows of bean's table matching the conditions of the
+// session into its cacher, e.g. engine.Where("status = ?", 1).WarmCache(new(User))
+func (session *Session) WarmCache(bean interface{}) error {
+	defer session.resetStatement()
+	if session.IsAutoClose {
+		defer session.Close()
+	}
+	return session.warmCache(bean, WarmCacheOptions{})
+}
+
+func (session *Session) warmCache(bean interface{}, options WarmCacheOptions) error {
+	table := session.Engine.TableInfo(bean)
+	cacher := session.Engine.getCacher2(table)
+	if cacher == nil || len(table.PrimaryKeys) == 0 {
+		session.Engine.LogWarn("[xorm:warmCache] no cacher or primary key, skipped:", table.Name)
+		return nil
+	}
+	session.Statement.RefTable = table
+	tableName := session.Statement.TableName()
+
+	var maxSize int
+	if lru, ok := cacher.(*LRUCacher); ok {
+		maxSize = lru.MaxElementSize
+	}
+
+	var cached int
+	err := session.NoCache().Iterate(bean, func(idx int, b interface{}) error {
+		id := session.Engine.IdOf(b)
+		sid, err := id.ToString()
+		if err != nil {
+			return err
+		}
+		cacher.PutBean(tableName, sid, b)
+		cached++
+		if options.Progress != nil && options.ProgressEvery > 0 && cached%options.ProgressEvery == 0 {
+			options.Progress(tableName, cached, false)
+		}
+		if maxSize > 0 && cached >= maxSize {
+			return errWarmCacheFull
+		}
+		return nil
+	})
+	if err == errWarmCacheFull {
+		err = nil
+	}
+	if err != nil {
+		return err
+	}
+	session.Engine.LogDebug("[xorm:warmCache] cached beans:", tableName, cached)
+	if options.Progress != nil {
+		options.Progress(tableName, cached, true)
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+package xorm
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-xorm/core"
+)
+
+const (
+	// default policy of the LRU cacher created for a table with cache tag
+	DEFAULT_CACHE_EXPIRED = time.Hour
+	DEFAULT_CACHE_SIZE    = 10000
+)
+
+// CacherConfig is the LRU cacher policy of a table. It could be given by the
+// parameters of cache tag, e.g. `xorm:"cache(ttl=5m,size=50000)"`, or be
+// registered by Engine.MapCacherConfig.
+type CacherConfig struct {
+	// Expired is the LRUCacher's Expired, 0 means DEFAULT_CACHE_EXPIRED
+	Expired time.Duration
+	// MaxElementSize is the LRUCacher's MaxElementSize, 0 means DEFAULT_CACHE_SIZE
+	MaxElementSize int
+	// Store is the cache store, nil means a new MemoryStore
+	Store core.CacheStore
+}
+
+// parseCacherConfig parses the parameters of cache tag, params is the content
+// between the parentheses, e.g. "ttl=5m,size=50000"
+func parseCacherConfig(params string) (*CacherConfig, error) {
+	config := &CacherConfig{}
+	for _, param := range strings.Split(params, ",") {
+		param = strings.TrimSpace(param)
+		if param == "" {
+			continue
+		}
+		kv := strings.SplitN(param, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("cache tag: unknown parameter %v", param)
+		}
+		name, value := strings.ToLower(strings.TrimSpace(kv[0])), strings.TrimSpace(kv[1])
+		switch name {
+		case "ttl", "expired":
+			d, err := time.ParseDuration(strings.ToLower(value))
+			if err != nil {
+				return nil, fmt.Errorf("cache tag: %v", err)
+			}
+			config.Expired = d
+		case "size":
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, fmt.Errorf("cache tag: %v", err)
+			}
+			config.MaxElementSize = n
+		default:
+			return nil, fmt.Errorf("cache tag: unknown parameter %v", param)
+		}
+	}
+	return config, nil
+}
+
+// merge returns a copy of config with the non-zero fields of other
+func (config *CacherConfig) merge(other *CacherConfig) *CacherConfig {
+	merged := &CacherConfig{}
+	if config != nil {
+		*merged = *config
+	}
+	if other == nil {
+		return merged
+	}
+	if other.Expired > 0 {
+		merged.Expired = other.Expired
+	}
+	if other.MaxElementSize > 0 {
+		merged.MaxElementSize = other.MaxElementSize
+	}
+	if other.Store != nil {
+		merged.Store = other.Store
+	}
+	return merged
+}
+
+func (config *CacherConfig) newCacher() *LRUCacher {
+	expired, size, store := config.Expired, config.MaxElementSize, config.Store
+	if expired <= 0 {
+		expired = DEFAULT_CACHE_EXPIRED
+	}
+	if size <= 0 {
+		size = DEFAULT_CACHE_SIZE
+	}
+	if store == nil {
+		store = NewMemoryStore()
+	}
+	return NewLRUCacher2(store, expired, size)
+}
+
+// MapCacherConfig registers the LRU cacher policy of a table, the table will
+// use a cacher of its own even without cache tag, unless it has nocache tag.
+// The non-zero fields override the parameters of cache tag.
+func (engine *Engine) MapCacherConfig(tableName string, config CacherConfig) {
+	engine.mutex.Lock()
+	defer engine.mutex.Unlock()
+	engine.cacherMutex.Lock()
+	defer engine.cacherMutex.Unlock()
+	if engine.cacherConfigs == nil {
+		engine.cacherConfigs = make(map[string]*CacherConfig)
+	}
+	engine.cacherConfigs[tableName] = &config
+
+	// tables already mapped
+	for _, table := range engine.Tables {
+		if table.Name == tableName {
+			tag := engine.cacheTags[tableName]
+			if tag == nil {
+				tag = &tableCacheTag{}
+			}
+			table.Cacher = engine.cacherOf(tableName, tag)
+		}
+	}
+}
+
+// tableCacheTag is the cache or nocache tag of a mapped table
+type tableCacheTag struct {
+	cache   bool
+	noCache bool
+	// config is the parameters of the cache tag
+	config *CacherConfig
+}
+
+// cacherOf returns the cacher of a table by its tag and its registered
+// config. nocache has priority, then the registered config merged over the
+// cache tag's parameters. It should be called with cacherMutex locked.
+func (engine *Engine) cacherOf(tableName string, tag *tableCacheTag) core.Cacher {
+	if tag.noCache {
+		engine.Logger.Info("no cache on table:", tableName)
+		return nil
+	}
+
+	hasCache, config := tag.cache, tag.config
+	if registered, ok := engine.cacherConfigs[tableName]; ok {
+		hasCache = true
+		config = config.merge(registered)
+	}
+	if !hasCache {
+		return nil
+	}
+
+	if config != nil {
+		engine.Logger.Info("enable LRU cache on table:", tableName)
+		return config.newCacher()
+	} else if engine.Cacher != nil { // !nash! use engine's cacher if provided
+		engine.Logger.Info("enable cache on table:", tableName)
+		return engine.Cacher
+	}
+	engine.Logger.Info("enable LRU cache on table:", tableName)
+	return NewLRUCacher2(NewMemoryStore(), DEFAULT_CACHE_EXPIRED, DEFAULT_CACHE_SIZE)
+}
@@ -122,6 +122,7 @@ Attention: the above 7 methods should be the last chainable method.
 
     engine.Limit().Find()
     // SELECT * FROM user LIMIT .. OFFSET ..
+    // SELECT * FROM user OFFSET .. ROWS FETCH NEXT .. ROWS ONLY // for oracle, ROWNUM if SetLegacyPaging
     engine.Top(5).Find()
     // SELECT TOP 5 * FROM user // for mssql
     // SELECT * FROM user LIMIT .. OFFSET 0 //for other databases
@@ -28,8 +28,10 @@ type Engine struct {
 	TagIdentifier string
 	Tables        map[reflect.Type]*core.Table
 
-	mutex  *sync.RWMutex
-	Cacher core.Cacher
+	mutex        *sync.RWMutex
+	Cacher       core.Cacher
+	stmtCache    *stmtCache
+	cacheFlights flightGroup
 
 	ShowSQL bool
 
@@ -44,6 +46,23 @@ type Engine struct {
 	TZLocation *time.Location
 
 	disableGlobalCache bool
+	cacherMutex        sync.Mutex
+	cacherConfigs      map[string]*CacherConfig
+	cacheTags          map[string]*tableCacheTag
+	broadcasterMutex   sync.RWMutex
+	cacheBroadcaster   CacheBroadcaster
+	queryCache         *queryCache
+	joinDeps           cacheDeps
+
+	sqlLogSink          SQLLogSink
+	slowQueryThreshold  time.Duration
+	redactSensitiveArgs bool
+	sensitiveCols       sensitiveColumns
+	validationRules     columnRules
+	legacyPaging        bool
+	hooks               []Hook
+	stats               engineStats
+	txRetryPolicy       TxRetryPolicy
 }
 
 func (engine *Engine) SetDisableGlobalCache(disable bool) {
@@ -136,6 +155,14 @@ func (engine *Engine) NoCache() *Session {
 	return session.NoCache()
 }
 
+// CacheFor caches the results of the next Query, Q or Find for ttl, see
+// Session.CacheFor
+func (engine *Engine) CacheFor(ttl time.Duration, tables ...string) *Session {
+	session := engine.NewSession()
+	session.IsAutoClose = true
+	return session.CacheFor(ttl, tables...)
+}
+
 func (engine *Engine) NoCascade() *Session {
 	session := engine.NewSession()
 	session.IsAutoClose = true
@@ -164,16 +191,29 @@ func (engine *Engine) Dialect() core.Dialect {
 
 // New a session
 func (engine *Engine) NewSession() *Session {
-	session := &Session{Engine: engine}
+	session := &Session{Engine: engine, id: nextSessionId()}
 	session.Init()
 	return session
 }
 
 // Close the engine
 func (engine *Engine) Close() error {
+	engine.stmtCache.clear()
 	return engine.db.Close()
 }
 
+// SetStmtCacheSize set the max prepared statements kept by engine, 0 or a
+// negative size means statements are closed after used.
+func (engine *Engine) SetStmtCacheSize(size int) {
+	engine.stmtCache.setMaxSize(size)
+}
+
+// StmtCacheStats returns the hits, misses and evictions of the prepared
+// statement cache
+func (engine *Engine) StmtCacheStats() StmtCacheStats {
+	return engine.stmtCache.getStats()
+}
+
 // Ping tests if database is alive
 func (engine *Engine) Ping() error {
 	session := engine.NewSession()
@@ -310,6 +350,13 @@ func (engine *Engine) NoAutoTime() *Session {
 	return session.NoAutoTime()
 }
 
+// NoValidate skips the validation of the beans by the next Insert or Update
+func (engine *Engine) NoValidate() *Session {
+	session := engine.NewSession()
+	session.IsAutoClose = true
+	return session.NoValidate()
+}
+
 // Retrieve all tables, columns, indexes' informations from database.
 func (engine *Engine) DBMetas() ([]*core.Table, error) {
 	tables, err := engine.dialect.GetTables()
@@ -681,6 +728,9 @@ func (engine *Engine) mapType(v reflect.Value) *core.Table {
 
 	hasCacheTag := false
 	hasNoCacheTag := false
+	var cacherConfig *CacherConfig
+	sensitiveCols := make([]string, 0)
+	rules := make(map[string]*columnRule)
 
 	for i := 0; i < t.NumField(); i++ {
 		tag := t.Field(i).Tag
@@ -693,7 +743,10 @@ func (engine *Engine) mapType(v reflect.Value) *core.Table {
 		if ormTagStr != "" {
 			col = &core.Column{FieldName: t.Field(i).Name, Nullable: true, IsPrimaryKey: false,
 				IsAutoIncrement: false, MapType: core.TWOSIDES, Indexes: make(map[string]bool)}
-			tags := strings.Split(ormTagStr, " ")
+			var tags []string
+			if tags, err = joinRegexTags(strings.Split(ormTagStr, " ")); err != nil {
+				engine.LogErrorf("%v.%v: %v", t.Name(), t.Field(i).Name, err)
+			}
 
 			if len(tags) > 0 {
 				if tags[0] == "-" {
@@ -706,6 +759,12 @@ func (engine *Engine) mapType(v reflect.Value) *core.Table {
 							col.FieldName = fmt.Sprintf("%v.%v", t.Field(i).Name, col.FieldName)
 							table.AddColumn(col)
 						}
+						for name := range engine.sensitiveCols.of(parentTable.Name) {
+							sensitiveCols = append(sensitiveCols, name)
+						}
+						for name, rule := range engine.validationRules.of(parentTable.Name) {
+							rules[name] = rule
+						}
 
 						continue
 					} else if fieldValue.Kind() == reflect.Ptr {
@@ -722,6 +781,12 @@ func (engine *Engine) mapType(v reflect.Value) *core.Table {
 							col.FieldName = fmt.Sprintf("%v.%v", t.Field(i).Name, col.FieldName)
 							table.AddColumn(col)
 						}
+						for name := range engine.sensitiveCols.of(parentTable.Name) {
+							sensitiveCols = append(sensitiveCols, name)
+						}
+						for name, rule := range engine.validationRules.of(parentTable.Name) {
+							rules[name] = rule
+						}
 
 						continue
 					}
@@ -729,7 +794,8 @@ func (engine *Engine) mapType(v reflect.Value) *core.Table {
 				}
 
 				indexNames := make(map[string]int)
-				var isIndex, isUnique bool
+				var isIndex, isUnique, isSensitive bool
+				var rule *columnRule
 				var preKey string
 				for j, key := range tags {
 					k := strings.ToUpper(key)
@@ -780,10 +846,25 @@ func (engine *Engine) mapType(v reflect.Value) *core.Table {
 						if !hasCacheTag {
 							hasCacheTag = true
 						}
+					case strings.HasPrefix(k, "CACHE(") && strings.HasSuffix(k, ")"):
+						hasCacheTag = true
+						cacherConfig, err = parseCacherConfig(key[len("CACHE")+1 : len(key)-1])
+						if err != nil {
+							engine.LogError(err)
+						}
 					case k == "NOCACHE":
 						if !hasNoCacheTag {
 							hasNoCacheTag = true
 						}
+					case k == "SENSITIVE":
+						isSensitive = true
+					case isValidationTag(k):
+						if rule == nil {
+							rule = &columnRule{}
+						}
+						if err := rule.parseTag(key); err != nil {
+							engine.LogError(err)
+						}
 					case k == "NOT":
 					default:
 						if strings.HasPrefix(k, "'") && strings.HasSuffix(k, "'") {
@@ -857,6 +938,13 @@ func (engine *Engine) mapType(v reflect.Value) *core.Table {
 					col.Name = engine.ColumnMapper.Obj2Table(t.Field(i).Name)
 				}
 
+				if isSensitive {
+					sensitiveCols = append(sensitiveCols, col.Name)
+				}
+				if rule != nil {
+					rules[col.Name] = rule
+				}
+
 				if isUnique {
 					indexNames[col.Name] = core.UniqueType
 				} else if isIndex {
@@ -903,18 +991,19 @@ func (engine *Engine) mapType(v reflect.Value) *core.Table {
 		table.AutoIncrement = col.Name
 	}
 
-	if hasCacheTag {
-		if engine.Cacher != nil { // !nash! use engine's cacher if provided
-			engine.Logger.Info("enable cache on table:", table.Name)
-			table.Cacher = engine.Cacher
-		} else {
-			engine.Logger.Info("enable LRU cache on table:", table.Name)
-			table.Cacher = NewLRUCacher2(NewMemoryStore(), time.Hour, 10000) // !nashtsai! HACK use LRU cacher for now
-		}
+	engine.cacherMutex.Lock()
+	tag := &tableCacheTag{cache: hasCacheTag, noCache: hasNoCacheTag, config: cacherConfig}
+	if engine.cacheTags == nil {
+		engine.cacheTags = make(map[string]*tableCacheTag)
+	}
+	engine.cacheTags[table.Name] = tag
+	table.Cacher = engine.cacherOf(table.Name, tag)
+	engine.cacherMutex.Unlock()
+	if len(sensitiveCols) > 0 {
+		engine.sensitiveCols.set(table.Name, sensitiveCols)
 	}
-	if hasNoCacheTag {
-		engine.Logger.Info("no cache on table:", table.Name)
-		table.Cacher = nil
+	if len(rules) > 0 {
+		engine.validationRules.set(table.Name, rules)
 	}
 
 	return table
@@ -969,15 +1058,7 @@ func (engine *Engine) IdOf(bean interface{}) core.PK {
 	v := reflect.Indirect(reflect.ValueOf(bean))
 	pk := make([]interface{}, len(table.PrimaryKeys))
 	for i, col := range table.PKColumns() {
-		pkField := v.FieldByName(col.FieldName)
-		switch pkField.Kind() {
-		case reflect.String:
-			pk[i] = pkField.String()
-		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-			pk[i] = pkField.Int()
-		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
-			pk[i] = pkField.Uint()
-		}
+		pk[i] = pkOfField(col, v.FieldByName(col.FieldName))
 	}
 	return core.PK(pk)
 }
@@ -12,4 +12,14 @@ var (
 	ErrCacheFailed     error = errors.New("Cache failed")
 	ErrNeedDeletedCond error = errors.New("Delete need at least one condition")
 	ErrNotImplemented  error = errors.New("Not implemented.")
+	ErrNestedTxOptions error = errors.New("Transaction options could not be set on a nested transaction")
+
+	// the classes of the database errors, matched by errors.Is
+	ErrDuplicateKey        error = errors.New("Duplicate key")
+	ErrForeignKeyViolation error = errors.New("Foreign key violation")
+	ErrNotNullViolation    error = errors.New("Not null violation")
+	ErrDeadlock            error = errors.New("Deadlock")
+	ErrSerialization       error = errors.New("Serialization failure")
+	ErrLockTimeout         error = errors.New("Lock wait timeout")
+	ErrConnection          error = errors.New("Connection error")
 )
@@ -0,0 +1,115 @@
+package xorm
+
+import (
+	"database/sql/driver"
+	"errors"
+	"net"
+	"reflect"
+	"strings"
+)
+
+// ErrorClassifier is implemented by the dialects which recognize the errors
+// of their drivers. ClassifyError returns ErrDuplicateKey,
+// ErrForeignKeyViolation, ErrNotNullViolation, ErrDeadlock,
+// ErrSerialization, ErrLockTimeout or ErrConnection, or nil for the other
+// errors.
+type ErrorClassifier interface {
+	ClassifyError(err error) error
+}
+
+// classifiedError is a driver's error with its class, errors.Is matches
+// both of them
+type classifiedError struct {
+	class error
+	err   error
+}
+
+func (e *classifiedError) Error() string {
+	return e.err.Error()
+}
+
+func (e *classifiedError) Is(target error) bool {
+	return target == e.class
+}
+
+func (e *classifiedError) Unwrap() error {
+	return e.err
+}
+
+// classifyError wraps err with its class by the engine's dialect, err is
+// returned as it is if it has no class
+func (engine *Engine) classifyError(err error) error {
+	if err == nil {
+		return nil
+	}
+	var classified *classifiedError
+	if errors.As(err, &classified) {
+		return err
+	}
+
+	var class error
+	if classifier, ok := engine.dialect.(ErrorClassifier); ok {
+		class = classifier.ClassifyError(err)
+	}
+	if class == nil && isConnectionError(err) {
+		class = ErrConnection
+	}
+	if class == nil {
+		return err
+	}
+	return &classifiedError{class: class, err: err}
+}
+
+func isConnectionError(err error) bool {
+	if errors.Is(err, driver.ErrBadConn) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// driverErrorCode returns the error number or code of a driver's error,
+// from the Number field like mysql and mssql or the Code field like pq and
+// sqlite3, without importing the drivers
+func driverErrorCode(err error) (number int64, code string) {
+	for ; err != nil; err = errors.Unwrap(err) {
+		if number, code = errorCodeOf(err); number != 0 || code != "" {
+			return
+		}
+	}
+	return
+}
+
+func errorCodeOf(err error) (number int64, code string) {
+	v := reflect.ValueOf(err)
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return
+	}
+	for _, name := range []string{"Number", "Code"} {
+		f := v.FieldByName(name)
+		if !f.IsValid() {
+			continue
+		}
+		switch f.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return f.Int(), ""
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			return int64(f.Uint()), ""
+		case reflect.String:
+			return 0, f.String()
+		}
+	}
+	return
+}
+
+// errorMessage returns the lower message of err for the dialects matching
+// the messages of the drivers without codes
+func errorMessage(err error) string {
+	return strings.ToLower(err.Error())
+}
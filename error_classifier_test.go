@@ -0,0 +1,113 @@
+package xorm
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/go-xorm/core"
+)
+
+// the errors of the drivers, with their code fields
+
+type mysqlTestError struct {
+	Number  uint16
+	Message string
+}
+
+func (e *mysqlTestError) Error() string { return fmt.Sprintf("Error %d: %s", e.Number, e.Message) }
+
+type pqTestErrorCode string
+
+type pqTestError struct {
+	Code    pqTestErrorCode
+	Message string
+}
+
+func (e *pqTestError) Error() string { return "pq: " + e.Message }
+
+type mssqlTestError struct {
+	Number  int32
+	Message string
+}
+
+func (e mssqlTestError) Error() string { return "mssql: " + e.Message }
+
+type sqlite3TestError struct {
+	Code int
+	msg  string
+}
+
+func (e sqlite3TestError) Error() string { return e.msg }
+
+func TestClassifyError(t *testing.T) {
+	var tests = []struct {
+		dialect core.Dialect
+		err     error
+		class   error
+	}{
+		{&mysql{}, &mysqlTestError{1062, "Duplicate entry '1' for key 'PRIMARY'"}, ErrDuplicateKey},
+		{&mysql{}, &mysqlTestError{1452, "Cannot add or update a child row"}, ErrForeignKeyViolation},
+		{&mysql{}, &mysqlTestError{1048, "Column 'name' cannot be null"}, ErrNotNullViolation},
+		{&mysql{}, &mysqlTestError{1213, "Deadlock found when trying to get lock"}, ErrDeadlock},
+		{&mysql{}, &mysqlTestError{1205, "Lock wait timeout exceeded"}, ErrLockTimeout},
+		{&mysql{}, errors.New("invalid connection"), ErrConnection},
+		{&mysql{}, driver.ErrBadConn, ErrConnection},
+		{&mysql{}, &mysqlTestError{1064, "You have an error in your SQL syntax"}, nil},
+		{&postgres{}, &pqTestError{"23505", "duplicate key value"}, ErrDuplicateKey},
+		{&postgres{}, &pqTestError{"40P01", "deadlock detected"}, ErrDeadlock},
+		{&postgres{}, &pqTestError{"40001", "could not serialize access"}, ErrSerialization},
+		{&postgres{}, &pqTestError{"08006", "connection failure"}, ErrConnection},
+		{&postgres{}, &pqTestError{"42601", "syntax error"}, nil},
+		{&mssql{}, mssqlTestError{2627, "Violation of PRIMARY KEY constraint"}, ErrDuplicateKey},
+		{&mssql{}, mssqlTestError{547, "The INSERT statement conflicted with the FOREIGN KEY constraint"}, ErrForeignKeyViolation},
+		{&mssql{}, mssqlTestError{547, "The INSERT statement conflicted with the CHECK constraint"}, nil},
+		{&mssql{}, mssqlTestError{1205, "was chosen as the deadlock victim"}, ErrDeadlock},
+		{&mssql{}, mssqlTestError{3960, "Snapshot isolation transaction aborted"}, ErrSerialization},
+		{&sqlite3{}, sqlite3TestError{19, "UNIQUE constraint failed: user.id"}, ErrDuplicateKey},
+		{&sqlite3{}, sqlite3TestError{19, "NOT NULL constraint failed: user.name"}, ErrNotNullViolation},
+		{&sqlite3{}, sqlite3TestError{5, "database is locked"}, ErrLockTimeout},
+		{&sqlite3{}, sqlite3TestError{6, "database table is locked"}, ErrLockTimeout},
+		{&oracle{}, errors.New("ORA-00001: unique constraint (U.PK) violated"), ErrDuplicateKey},
+		{&oracle{}, errors.New("ORA-00060: deadlock detected while waiting for resource"), ErrDeadlock},
+		{&oracle{}, errors.New("ORA-08177: can't serialize access for this transaction"), ErrSerialization},
+	}
+
+	for _, test := range tests {
+		engine := &Engine{dialect: test.dialect}
+		for _, err := range []error{test.err, fmt.Errorf("wrapped: %w", test.err)} {
+			classified := engine.classifyError(err)
+			if !errors.Is(classified, err) {
+				t.Errorf("%T %v: the driver error is lost", test.dialect, err)
+			}
+			if test.class == nil {
+				if classified != err {
+					t.Errorf("%T %v: classified as %v, want none", test.dialect, err, classified)
+				}
+				continue
+			}
+			if !errors.Is(classified, test.class) {
+				t.Errorf("%T %v: not classified as %v", test.dialect, err, test.class)
+			}
+		}
+	}
+}
+
+func TestIsRetryableTxError(t *testing.T) {
+	engine := &Engine{dialect: &mysql{}}
+	var tests = []struct {
+		err       error
+		retryable bool
+	}{
+		{&mysqlTestError{1213, "Deadlock found when trying to get lock"}, true},
+		{&mysqlTestError{1205, "Lock wait timeout exceeded"}, false},
+		{&mysqlTestError{1062, "Duplicate entry '1' for key 'PRIMARY'"}, false},
+	}
+
+	for _, test := range tests {
+		if retryable := engine.isRetryableTxError(test.err); retryable != test.retryable {
+			t.Errorf("%v: retryable %v, want %v", test.err, retryable, test.retryable)
+		}
+	}
+}
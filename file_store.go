@@ -0,0 +1,376 @@
+// FileStore implements CacheStore on an append-only file
+package xorm
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-xorm/core"
+)
+
+var (
+	_ core.CacheStore = &FileStore{}
+	_ StoredTimer     = &FileStore{}
+)
+
+const (
+	fileStorePut byte = 1
+	fileStoreDel byte = 2
+
+	// crc32 | op | stored time | key length | value length
+	fileStoreHeaderSize = 4 + 1 + 8 + 4 + 4
+
+	// default file size from which FileStore compacts the log
+	DEFAULT_COMPACT_SIZE int64 = 32 << 20
+
+	// max size of the key and value of a record, a larger one in a header
+	// is corrupted
+	fileStoreMaxBodySize int64 = 1 << 30
+)
+
+var errFileStoreCorrupted = errors.New("file store record corrupted")
+
+type fileStoreEntry struct {
+	offset int64 // offset of the value
+	size   int   // size of the value
+	stored int64 // unix nano time the value was put
+}
+
+// FileStore is a disk based CacheStore, which appends every Put and Del to a
+// log file and keeps the position of the values in memory, so the cache
+// survives restarts while only the keys use memory. Values are gob encoded,
+// the types of the cached beans are registered to gob on Put, but after a
+// restart they should be registered by gob.Register before they are read.
+// Only the beans are reused by a LRUCacher after a restart, with the time
+// they were put so they expire as if it was not restarted, the beans of a
+// table are all cleared by DelPrefix.
+//
+// The log is rewritten with only the live values when it grows over
+// CompactSize and half of it is garbage. A record partially written by a
+// crash is detected by its checksum and truncated when the file is opened.
+type FileStore struct {
+	path  string
+	file  *os.File
+	index map[string]fileStoreEntry
+	size  int64 // size of the log file
+	live  int64 // bytes of the records still in index
+	mutex sync.RWMutex
+
+	// CompactSize is the file size from which the log could be compacted
+	CompactSize int64
+	// SyncWrites calls fsync after every write if true
+	SyncWrites bool
+}
+
+// NewFileStore opens or creates the log file at path and recovers the index
+// from it
+func NewFileStore(path string) (*FileStore, error) {
+	s := &FileStore{path: path, CompactSize: DEFAULT_COMPACT_SIZE}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *FileStore) open() error {
+	file, err := os.OpenFile(s.path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	s.file = file
+	s.index = make(map[string]fileStoreEntry)
+	s.size, s.live = 0, 0
+	return s.recover()
+}
+
+// recover reads all the records to rebuild the index, and truncates the
+// file at the first broken record
+func (s *FileStore) recover() error {
+	info, err := s.file.Stat()
+	if err != nil {
+		return err
+	}
+	if _, err := s.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	r := bufio.NewReader(s.file)
+	var offset int64
+	for {
+		op, stored, key, value, err := readFileStoreRecord(r, info.Size()-offset-fileStoreHeaderSize)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			// a crash in the middle of a write, drop the tail
+			if err := s.file.Truncate(offset); err != nil {
+				return err
+			}
+			if err := s.file.Sync(); err != nil {
+				return err
+			}
+			break
+		}
+
+		recordSize := int64(fileStoreHeaderSize + len(key) + len(value))
+		if old, ok := s.index[key]; ok {
+			s.live -= int64(fileStoreHeaderSize + len(key) + old.size)
+			delete(s.index, key)
+		}
+		if op == fileStorePut {
+			s.index[key] = fileStoreEntry{offset: offset + recordSize - int64(len(value)), size: len(value), stored: stored}
+			s.live += recordSize
+		}
+		offset += recordSize
+	}
+	s.size = offset
+	return nil
+}
+
+// readFileStoreRecord reads the next record of r, whose key and value could
+// not be larger than maxBody, the bytes left after the header
+func readFileStoreRecord(r io.Reader, maxBody int64) (op byte, stored int64, key string, value []byte, err error) {
+	header := make([]byte, fileStoreHeaderSize)
+	if _, err = io.ReadFull(r, header); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			err = errFileStoreCorrupted
+		}
+		return
+	}
+	sum := binary.LittleEndian.Uint32(header[0:4])
+	op = header[4]
+	stored = int64(binary.LittleEndian.Uint64(header[5:13]))
+	keyLen := binary.LittleEndian.Uint32(header[13:17])
+	valueLen := binary.LittleEndian.Uint32(header[17:21])
+	if op != fileStorePut && op != fileStoreDel {
+		return 0, 0, "", nil, errFileStoreCorrupted
+	}
+	// the lengths are checked before the checksum, so a broken header
+	// doesn't make a huge allocation
+	bodySize := int64(keyLen) + int64(valueLen)
+	if bodySize > maxBody || bodySize > fileStoreMaxBodySize {
+		return 0, 0, "", nil, errFileStoreCorrupted
+	}
+
+	body := make([]byte, bodySize)
+	if _, err = io.ReadFull(r, body); err != nil {
+		return 0, 0, "", nil, errFileStoreCorrupted
+	}
+	crc := crc32.NewIEEE()
+	crc.Write(header[4:])
+	crc.Write(body)
+	if crc.Sum32() != sum {
+		return 0, 0, "", nil, errFileStoreCorrupted
+	}
+	return op, stored, string(body[:keyLen]), body[keyLen:], nil
+}
+
+func encodeFileStoreRecord(op byte, stored int64, key string, value []byte) []byte {
+	record := make([]byte, fileStoreHeaderSize+len(key)+len(value))
+	record[4] = op
+	binary.LittleEndian.PutUint64(record[5:13], uint64(stored))
+	binary.LittleEndian.PutUint32(record[13:17], uint32(len(key)))
+	binary.LittleEndian.PutUint32(record[17:21], uint32(len(value)))
+	copy(record[fileStoreHeaderSize:], key)
+	copy(record[fileStoreHeaderSize+len(key):], value)
+	binary.LittleEndian.PutUint32(record[0:4], crc32.ChecksumIEEE(record[4:]))
+	return record
+}
+
+// append should be called with mutex locked
+func (s *FileStore) append(op byte, key string, value []byte) error {
+	stored := time.Now().UnixNano()
+	record := encodeFileStoreRecord(op, stored, key, value)
+	if _, err := s.file.WriteAt(record, s.size); err != nil {
+		// a partial write would be truncated by the next recover
+		s.file.Truncate(s.size)
+		return err
+	}
+	if s.SyncWrites {
+		if err := s.file.Sync(); err != nil {
+			return err
+		}
+	}
+
+	if old, ok := s.index[key]; ok {
+		s.live -= int64(fileStoreHeaderSize + len(key) + old.size)
+		delete(s.index, key)
+	}
+	if op == fileStorePut {
+		s.index[key] = fileStoreEntry{offset: s.size + int64(len(record)-len(value)), size: len(value), stored: stored}
+		s.live += int64(len(record))
+	}
+	s.size += int64(len(record))
+
+	if s.CompactSize > 0 && s.size >= s.CompactSize && s.size-s.live > s.size/2 {
+		return s.compact()
+	}
+	return nil
+}
+
+// registerGob registers the type of value to gob, a type registered by
+// the user with another name is kept as it is
+func registerGob(value interface{}) {
+	defer func() {
+		recover()
+	}()
+	gob.Register(value)
+}
+
+func (s *FileStore) Put(key string, value interface{}) error {
+	registerGob(value)
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(&value); err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.file == nil {
+		return os.ErrClosed
+	}
+	return s.append(fileStorePut, key, buf.Bytes())
+}
+
+func (s *FileStore) Get(key string) (interface{}, error) {
+	s.mutex.RLock()
+	entry, ok := s.index[key]
+	if !ok || s.file == nil {
+		s.mutex.RUnlock()
+		return nil, ErrNotExist
+	}
+	data := make([]byte, entry.size)
+	_, err := s.file.ReadAt(data, entry.offset)
+	s.mutex.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+
+	var value interface{}
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// StoredTime returns the time the value of key was put
+func (s *FileStore) StoredTime(key string) (time.Time, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	entry, ok := s.index[key]
+	if !ok || s.file == nil {
+		return time.Time{}, ErrNotExist
+	}
+	return time.Unix(0, entry.stored), nil
+}
+
+func (s *FileStore) Del(key string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, ok := s.index[key]; !ok || s.file == nil {
+		return nil
+	}
+	return s.append(fileStoreDel, key, nil)
+}
+
+// DelPrefix deletes all the keys beginning with prefix, including the ones
+// put before the store was opened
+func (s *FileStore) DelPrefix(prefix string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.file == nil {
+		return nil
+	}
+	for key := range s.index {
+		if strings.HasPrefix(key, prefix) {
+			if err := s.append(fileStoreDel, key, nil); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Compact rewrites the log file with only the live values
+func (s *FileStore) Compact() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.file == nil {
+		return os.ErrClosed
+	}
+	return s.compact()
+}
+
+// compact should be called with mutex locked
+func (s *FileStore) compact() error {
+	tmpPath := s.path + ".compact"
+	tmp, err := os.OpenFile(tmpPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	index := make(map[string]fileStoreEntry, len(s.index))
+	w := bufio.NewWriter(tmp)
+	var offset int64
+	for key, entry := range s.index {
+		value := make([]byte, entry.size)
+		if _, err = s.file.ReadAt(value, entry.offset); err != nil {
+			break
+		}
+		record := encodeFileStoreRecord(fileStorePut, entry.stored, key, value)
+		if _, err = w.Write(record); err != nil {
+			break
+		}
+		index[key] = fileStoreEntry{offset: offset + int64(len(record)-len(value)), size: len(value), stored: entry.stored}
+		offset += int64(len(record))
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+
+	// rename is atomic, a crash leaves either the old or the new file
+	if err = os.Rename(tmpPath, s.path); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if dir, err := os.Open(filepath.Dir(s.path)); err == nil {
+		dir.Sync()
+		dir.Close()
+	}
+
+	s.file.Close()
+	s.file = tmp
+	s.index = index
+	s.size, s.live = offset, offset
+	return nil
+}
+
+// Close closes the log file, the store could not be used after closed
+func (s *FileStore) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
@@ -0,0 +1,224 @@
+package xorm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestReadFileStoreRecord(t *testing.T) {
+	put := encodeFileStoreRecord(fileStorePut, 42, "user-1", []byte("value"))
+	del := encodeFileStoreRecord(fileStoreDel, 43, "user-1", nil)
+
+	badSum := append([]byte{}, put...)
+	badSum[len(badSum)-1] ^= 1
+	badOp := append([]byte{}, put...)
+	badOp[4] = 9
+	// a broken header claiming a 4G value
+	huge := append([]byte{}, put...)
+	binary.LittleEndian.PutUint32(huge[17:21], 0xffffffff)
+
+	var tests = []struct {
+		name    string
+		record  []byte
+		maxBody int64
+		op      byte
+		stored  int64
+		key     string
+		value   string
+		err     error
+	}{
+		{"put", put, 1 << 20, fileStorePut, 42, "user-1", "value", nil},
+		{"del", del, 1 << 20, fileStoreDel, 43, "user-1", "", nil},
+		{"empty", nil, 1 << 20, 0, 0, "", "", io.EOF},
+		{"partial header", put[:fileStoreHeaderSize-1], 1 << 20, 0, 0, "", "", errFileStoreCorrupted},
+		{"partial body", put[:len(put)-1], 1 << 20, 0, 0, "", "", errFileStoreCorrupted},
+		{"bad checksum", badSum, 1 << 20, 0, 0, "", "", errFileStoreCorrupted},
+		{"bad op", badOp, 1 << 20, 0, 0, "", "", errFileStoreCorrupted},
+		{"over the file", put, int64(len(put) - fileStoreHeaderSize - 1), 0, 0, "", "", errFileStoreCorrupted},
+		{"over the max size", huge, 1 << 40, 0, 0, "", "", errFileStoreCorrupted},
+	}
+
+	for _, test := range tests {
+		op, stored, key, value, err := readFileStoreRecord(bytes.NewReader(test.record), test.maxBody)
+		if err != test.err {
+			t.Errorf("%v: error %v, want %v", test.name, err, test.err)
+			continue
+		}
+		if op != test.op || stored != test.stored || key != test.key || string(value) != test.value {
+			t.Errorf("%v: read %v %v %q %q, want %v %v %q %q", test.name, op, stored, key, value,
+				test.op, test.stored, test.key, test.value)
+		}
+	}
+}
+
+func newTestFileStore(t *testing.T) (*FileStore, string) {
+	dir, err := ioutil.TempDir("", "xorm_file_store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "cache.log")
+	s, err := NewFileStore(path)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return s, path
+}
+
+// checkFileStore checks the values of s, an empty one should not exist
+func checkFileStore(t *testing.T, name string, s *FileStore, values map[string]string) {
+	for key, want := range values {
+		v, err := s.Get(key)
+		if want == "" {
+			if err != ErrNotExist {
+				t.Errorf("%v: get %v = %v, %v, want not exist", name, key, v, err)
+			}
+			continue
+		}
+		if err != nil || v != want {
+			t.Errorf("%v: get %v = %v, %v, want %v", name, key, v, err, want)
+		}
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	s, path := newTestFileStore(t)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	for key, value := range map[string]string{"user-1": "a", "user-2": "b", "group-1": "c"} {
+		if err := s.Put(key, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Put("user-1", "a2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Del("user-2"); err != nil {
+		t.Fatal(err)
+	}
+	values := map[string]string{"user-1": "a2", "user-2": "", "group-1": "c", "user-3": ""}
+	checkFileStore(t, "put", s, values)
+
+	// the index is recovered from the log
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if s, err := NewFileStore(path); err != nil {
+		t.Fatal(err)
+	} else {
+		checkFileStore(t, "reopened", s, values)
+		s.Close()
+	}
+}
+
+func TestFileStoreTruncated(t *testing.T) {
+	s, path := newTestFileStore(t)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	if err := s.Put("user-1", "a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Put("user-2", "b"); err != nil {
+		t.Fatal(err)
+	}
+	size := s.size
+	s.Close()
+
+	// a crash in the middle of the last record
+	if err := os.Truncate(path, size-3); err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	checkFileStore(t, "truncated", s, map[string]string{"user-1": "a", "user-2": ""})
+
+	// the broken tail is dropped, so the new records are read after it
+	if err := s.Put("user-3", "c"); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+	if s, err = NewFileStore(path); err != nil {
+		t.Fatal(err)
+	}
+	checkFileStore(t, "appended", s, map[string]string{"user-1": "a", "user-2": "", "user-3": "c"})
+}
+
+func TestFileStoreCompact(t *testing.T) {
+	s, path := newTestFileStore(t)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	for i := 0; i < 10; i++ {
+		if err := s.Put("user-1", i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Put("user-2", 2); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Del("user-2"); err != nil {
+		t.Fatal(err)
+	}
+	stored, _ := s.StoredTime("user-1")
+	before := s.size
+	if err := s.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	if s.size >= before || s.size != s.live {
+		t.Errorf("compacted size %v, live %v, was %v", s.size, s.live, before)
+	}
+	s.Close()
+
+	if s, err := NewFileStore(path); err != nil {
+		t.Fatal(err)
+	} else {
+		defer s.Close()
+		if v, err := s.Get("user-1"); err != nil || v != 9 {
+			t.Errorf("get user-1 = %v, %v, want 9", v, err)
+		}
+		if _, err := s.Get("user-2"); err != ErrNotExist {
+			t.Errorf("get user-2: %v, want not exist", err)
+		}
+		if got, _ := s.StoredTime("user-1"); !got.Equal(stored) {
+			t.Errorf("stored %v, want %v", got, stored)
+		}
+	}
+}
+
+func TestLRUCacherFileStoreRestart(t *testing.T) {
+	s, path := newTestFileStore(t)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	cacher := NewLRUCacher2(s, time.Hour, 100)
+	cacher.PutBean("user", "1", "a")
+	s.Close()
+
+	// restarted before and after the bean expired
+	var tests = []struct {
+		name    string
+		expired time.Duration
+		want    interface{}
+	}{
+		{"live", time.Hour, "a"},
+		{"expired", time.Nanosecond, nil},
+	}
+	for _, test := range tests {
+		s, err := NewFileStore(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cacher := NewLRUCacher2(s, test.expired, 100)
+		if v := cacher.GetBean("user", "1"); v != test.want {
+			t.Errorf("%v: get bean %v, want %v", test.name, v, test.want)
+		}
+		s.Close()
+	}
+}
@@ -1,6 +1,8 @@
 package xorm
 
 import (
+	"database/sql/driver"
+	"encoding/json"
 	"fmt"
 	"reflect"
 	"sort"
@@ -70,6 +72,126 @@ func sliceEq(left, right []string) bool {
 	return true
 }
 
+// pkOfField returns the cache id of a primary key field. Strings and integers
+// are kept as they are, other types such as UUID are identified by their sql
+// value, numeric as int64 and the others as string.
+func pkOfField(col *core.Column, field reflect.Value) interface{} {
+	switch field.Kind() {
+	case reflect.String:
+		return field.String()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return field.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return field.Uint()
+	case reflect.Ptr:
+		if field.IsNil() {
+			return nil
+		}
+		return pkOfField(col, field.Elem())
+	case reflect.Invalid:
+		return nil
+	}
+
+	v := field.Interface()
+	if valuer, ok := v.(driver.Valuer); ok {
+		if dv, err := valuer.Value(); err == nil {
+			v = dv
+		}
+	} else if sv, ok := storedOfField(col, field); ok {
+		// the same value as stored, which pkOfBytes reads back
+		return sv
+	}
+	if bs, ok := v.([]byte); ok {
+		v = string(bs)
+	}
+	if col.SQLType.IsNumeric() {
+		if id, err := strconv.ParseInt(fmt.Sprintf("%v", v), 10, 64); err == nil {
+			return id
+		}
+	}
+	if sv, ok := v.(string); ok {
+		return sv
+	}
+	return fmt.Sprintf("%v", v)
+}
+
+// storedOfField returns the string stored by value2Interface for an array,
+// slice or map field, the bytes of a blob or the json of a text
+func storedOfField(col *core.Column, field reflect.Value) (string, bool) {
+	switch field.Kind() {
+	case reflect.Array, reflect.Slice:
+		if col.SQLType.IsBlob() && field.Type().Elem().Kind() == reflect.Uint8 {
+			bs := make([]byte, field.Len())
+			reflect.Copy(reflect.ValueOf(bs), field)
+			return string(bs), true
+		}
+	case reflect.Map:
+	default:
+		return "", false
+	}
+	bs, err := json.Marshal(field.Interface())
+	if err != nil {
+		return "", false
+	}
+	return string(bs), true
+}
+
+// pkOfBytes converts a primary key queried from database to the same type
+// pkOfField returns for the bean's field, so ids from cache and from beans
+// could be compared.
+func pkOfBytes(table *core.Table, col *core.Column, data []byte) (interface{}, error) {
+	kind := reflect.Invalid
+	if table.Type != nil {
+		if field, ok := table.Type.FieldByName(col.FieldName); ok {
+			t := field.Type
+			if t.Kind() == reflect.Ptr {
+				t = t.Elem()
+			}
+			kind = t.Kind()
+		}
+	}
+
+	switch kind {
+	case reflect.String:
+		return string(data), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.ParseInt(string(data), 10, 64)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.ParseUint(string(data), 10, 64)
+	}
+	if col.SQLType.IsNumeric() {
+		return strconv.ParseInt(string(data), 10, 64)
+	}
+	return string(data), nil
+}
+
+// mapKeyOf converts a primary key value to the key type of the map which
+// Find fills
+func mapKeyOf(id interface{}, keyType reflect.Type) (reflect.Value, error) {
+	sid := fmt.Sprintf("%v", id)
+	switch keyType.Kind() {
+	case reflect.String:
+		return reflect.ValueOf(sid).Convert(keyType), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		x, err := strconv.ParseInt(sid, 10, 64)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		return reflect.ValueOf(x).Convert(keyType), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		x, err := strconv.ParseUint(sid, 10, 64)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		return reflect.ValueOf(x).Convert(keyType), nil
+	case reflect.Interface:
+		if id != nil {
+			return reflect.ValueOf(id), nil
+		}
+	}
+	return reflect.Value{}, fmt.Errorf("can't use pk %v as map key type %v", id, keyType)
+}
+
 func reflect2value(rawValue *reflect.Value) (str string, err error) {
 	aa := reflect.TypeOf((*rawValue).Interface())
 	vv := reflect.ValueOf((*rawValue).Interface())
@@ -0,0 +1,94 @@
+package xorm
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// HookContext is a sql executed by a session, passed to the hooks
+type HookContext struct {
+	// Ctx is the session's context, replaced by the one returned by
+	// BeforeProcess for the next hooks
+	Ctx       context.Context
+	SQL       string
+	Args      []interface{}
+	StartTime time.Time
+	// the fields below are set before AfterProcess
+	ExecuteTime time.Duration
+	// Result is the result of an exec, nil for a query
+	Result sql.Result
+	Err    error
+
+	query bool
+}
+
+// Hook is called around every sql executed by the sessions of an engine. An
+// error returned by BeforeProcess aborts the execution, AfterProcess is still
+// called with it. An error returned by AfterProcess replaces the execution's
+// error.
+type Hook interface {
+	BeforeProcess(c *HookContext) (context.Context, error)
+	AfterProcess(c *HookContext) error
+}
+
+// AddHook registers a hook called around every executed sql, hooks are
+// called in the order they are added
+func (engine *Engine) AddHook(hook Hook) {
+	engine.hooks = append(engine.hooks, hook)
+}
+
+// Context set the context passed to the hooks
+func (engine *Engine) Context(ctx context.Context) *Session {
+	session := engine.NewSession()
+	session.IsAutoClose = true
+	return session.Context(ctx)
+}
+
+// Context set the context passed to the hooks of the session's sql
+func (session *Session) Context(ctx context.Context) *Session {
+	session.ctx = ctx
+	return session
+}
+
+// beforeProcess runs the hooks before sqlStr is executed, query is true if
+// it returns rows
+func (session *Session) beforeProcess(sqlStr string, args []interface{}, query bool) (*HookContext, error) {
+	c := &HookContext{
+		Ctx:       session.ctx,
+		SQL:       sqlStr,
+		Args:      args,
+		StartTime: time.Now(),
+		query:     query,
+	}
+	if c.Ctx == nil {
+		c.Ctx = context.Background()
+	}
+	for _, hook := range session.Engine.hooks {
+		ctx, err := hook.BeforeProcess(c)
+		if err != nil {
+			return c, err
+		}
+		if ctx != nil {
+			c.Ctx = ctx
+		}
+	}
+	return c, nil
+}
+
+// afterProcess runs the hooks after the sql of c is executed, or aborted by
+// a hook, counts and logs the sql and returns the classified error of the
+// execution or the hooks, wrapped in a SQLError
+func (session *Session) afterProcess(c *HookContext, res sql.Result, err error) error {
+	c.ExecuteTime = time.Since(c.StartTime)
+	c.Result = res
+	c.Err = err
+	for _, hook := range session.Engine.hooks {
+		if err := hook.AfterProcess(c); err != nil {
+			c.Err = err
+		}
+	}
+	session.countSQL(c.SQL, c.query, c.Err, c.ExecuteTime)
+	session.logSQLEvent(c.SQL, c.Args, c.StartTime, res, c.Err)
+	return session.sqlError(c.SQL, c.Args, session.Engine.classifyError(c.Err))
+}
@@ -4,6 +4,8 @@ package xorm
 import (
 	"container/list"
 	"fmt"
+	"math/rand"
+	"reflect"
 	"sync"
 	"time"
 
@@ -21,6 +23,52 @@ type LRUCacher struct {
 	MaxElementSize int
 	Expired        time.Duration
 	GcInterval     time.Duration
+	// EarlyRefresh, if > 0, is the window before Expired elapses since an
+	// element was put, in which a get reports a miss with a probability
+	// growing to 1, so one caller reloads the element before all the callers
+	// miss it at the same time.
+	EarlyRefresh time.Duration
+	// MaxMemorySize, if > 0, is the budget in bytes of the estimated size of
+	// the cached beans and ids, the least recently used ones are evicted
+	// when it is exceeded.
+	MaxMemorySize int64
+
+	memorySize int64
+	stats      map[string]*CacheStats
+	// joined table name => sql => element of the ids read from it
+	depIndex map[string]map[string]*list.Element
+}
+
+// PrefixDeleter is implemented by the CacheStores which keep values the
+// LRUCacher hasn't indexed, like the ones persisted before a restart, so
+// all the beans of a table could be cleared
+type PrefixDeleter interface {
+	DelPrefix(prefix string) error
+}
+
+// StoredTimer is implemented by the CacheStores which keep the time a value
+// was put, so a bean persisted before a restart keeps its age when the
+// LRUCacher indexes it again
+type StoredTimer interface {
+	StoredTime(key string) (time.Time, error)
+}
+
+// CacheStats counts the cache operations on a table
+type CacheStats struct {
+	Hits        int64
+	Misses      int64
+	Evictions   int64
+	Expirations int64
+}
+
+// LRUCacherStats is a snapshot of a LRUCacher's statistics
+type LRUCacherStats struct {
+	Tables map[string]CacheStats
+	Beans  int
+	Ids    int
+	// estimated bytes of the cached elements, only counted when
+	// MaxMemorySize > 0
+	MemorySize int64
 }
 
 func NewLRUCacher(store core.CacheStore, maxElementSize int) *LRUCacher {
@@ -50,6 +98,79 @@ func (m *LRUCacher) RunGC() {
 	})
 }
 
+// Stats returns the counters of every table and the cache's size
+func (m *LRUCacher) Stats() LRUCacherStats {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	stats := LRUCacherStats{
+		Tables:     make(map[string]CacheStats, len(m.stats)),
+		Beans:      m.idList.Len(),
+		Ids:        m.sqlList.Len(),
+		MemorySize: m.memorySize,
+	}
+	for tableName, tableStats := range m.stats {
+		stats.Tables[tableName] = *tableStats
+	}
+	return stats
+}
+
+// ResetStats clears the counters of all the tables
+func (m *LRUCacher) ResetStats() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.stats = nil
+}
+
+// tableStats should be called with mutex locked
+func (m *LRUCacher) tableStats(tableName string) *CacheStats {
+	if m.stats == nil {
+		m.stats = make(map[string]*CacheStats)
+	}
+	stats, ok := m.stats[tableName]
+	if !ok {
+		stats = &CacheStats{}
+		m.stats[tableName] = stats
+	}
+	return stats
+}
+
+func (m *LRUCacher) countGet(tableName string, v interface{}) {
+	if v != nil {
+		m.tableStats(tableName).Hits++
+	} else {
+		m.tableStats(tableName).Misses++
+	}
+}
+
+// sizeOf estimates the bytes of v only if memory budget is used
+func (m *LRUCacher) sizeOf(v interface{}) int64 {
+	if m.MaxMemorySize <= 0 {
+		return 0
+	}
+	return estimateSize(v)
+}
+
+// evictOverMemory removes the least recently used beans and ids until the
+// memory budget is met, it should be called with mutex locked
+func (m *LRUCacher) evictOverMemory() {
+	for m.MaxMemorySize > 0 && m.memorySize > m.MaxMemorySize {
+		idEl, sqlEl := m.idList.Front(), m.sqlList.Front()
+		if idEl == nil && sqlEl == nil {
+			return
+		}
+		if sqlEl == nil || (idEl != nil &&
+			idEl.Value.(*idNode).lastVisit.Before(sqlEl.Value.(*sqlNode).lastVisit)) {
+			node := idEl.Value.(*idNode)
+			m.tableStats(node.tbName).Evictions++
+			m.delBean(node.tbName, node.id)
+		} else {
+			node := sqlEl.Value.(*sqlNode)
+			m.tableStats(node.tbName).Evictions++
+			m.delIds(node.tbName, node.sql)
+		}
+	}
+}
+
 // GC check ids lit and sql list to remove all element expired
 func (m *LRUCacher) GC() {
 	//fmt.Println("begin gc ...")
@@ -64,6 +185,7 @@ func (m *LRUCacher) GC() {
 			next := e.Next()
 			//fmt.Println("removing ...", e.Value)
 			node := e.Value.(*idNode)
+			m.tableStats(node.tbName).Expirations++
 			m.delBean(node.tbName, node.id)
 			e = next
 		} else {
@@ -80,6 +202,7 @@ func (m *LRUCacher) GC() {
 			next := e.Next()
 			//fmt.Println("removing ...", e.Value)
 			node := e.Value.(*sqlNode)
+			m.tableStats(node.tbName).Expirations++
 			m.delIds(node.tbName, node.sql)
 			e = next
 		} else {
@@ -89,24 +212,52 @@ func (m *LRUCacher) GC() {
 	}
 }
 
+// refreshEarly reports if an element put at stored should be reloaded before
+// it expires
+func (m *LRUCacher) refreshEarly(stored time.Time) bool {
+	if m.EarlyRefresh <= 0 {
+		return false
+	}
+	remain := m.Expired - time.Now().Sub(stored)
+	if remain >= m.EarlyRefresh {
+		return false
+	}
+	if remain <= 0 {
+		return true
+	}
+	return rand.Int63n(int64(m.EarlyRefresh)) >= int64(remain)
+}
+
 // Get all bean's ids according to sql and parameter from cache
 func (m *LRUCacher) GetIds(tableName, sql string) interface{} {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
+	v := m.getIds(tableName, sql)
+	m.countGet(tableName, v)
+	return v
+}
+
+func (m *LRUCacher) getIds(tableName, sql string) interface{} {
 	if _, ok := m.sqlIndex[tableName]; !ok {
 		m.sqlIndex[tableName] = make(map[string]*list.Element)
 	}
 	if v, err := m.store.Get(sql); err == nil {
 		if el, ok := m.sqlIndex[tableName][sql]; !ok {
-			el = m.sqlList.PushBack(newSqlNode(tableName, sql))
-			m.sqlIndex[tableName][sql] = el
+			// ids not put by this cacher, like the ones persisted before a
+			// restart, missed the invalidations of their table meanwhile
+			m.store.Del(sql)
+			return nil
 		} else {
 			lastTime := el.Value.(*sqlNode).lastVisit
 			// if expired, remove the node and return nil
 			if time.Now().Sub(lastTime) > m.Expired {
+				m.tableStats(tableName).Expirations++
 				m.delIds(tableName, sql)
 				return nil
 			}
+			if m.refreshEarly(el.Value.(*sqlNode).stored) {
+				return nil
+			}
 			m.sqlList.MoveToBack(el)
 			el.Value.(*sqlNode).lastVisit = time.Now()
 		}
@@ -122,6 +273,12 @@ func (m *LRUCacher) GetIds(tableName, sql string) interface{} {
 func (m *LRUCacher) GetBean(tableName string, id string) interface{} {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
+	v := m.getBean(tableName, id)
+	m.countGet(tableName, v)
+	return v
+}
+
+func (m *LRUCacher) getBean(tableName string, id string) interface{} {
 	if _, ok := m.idIndex[tableName]; !ok {
 		m.idIndex[tableName] = make(map[string]*list.Element)
 	}
@@ -131,15 +288,35 @@ func (m *LRUCacher) GetBean(tableName string, id string) interface{} {
 			lastTime := el.Value.(*idNode).lastVisit
 			// if expired, remove the node and return nil
 			if time.Now().Sub(lastTime) > m.Expired {
+				m.tableStats(tableName).Expirations++
 				m.delBean(tableName, id)
 				//m.clearIds(tableName)
 				return nil
 			}
+			if m.refreshEarly(el.Value.(*idNode).stored) {
+				return nil
+			}
 			m.idList.MoveToBack(el)
 			el.Value.(*idNode).lastVisit = time.Now()
 		} else {
-			el = m.idList.PushBack(newIdNode(tableName, id))
+			node := newIdNode(tableName, id)
+			if timer, ok := m.store.(StoredTimer); ok {
+				if stored, err := timer.StoredTime(tid); err == nil {
+					// the visits before the restart are unknown, so it
+					// expires from the time it was put
+					if time.Now().Sub(stored) > m.Expired {
+						m.tableStats(tableName).Expirations++
+						m.store.Del(tid)
+						return nil
+					}
+					node.stored = stored
+				}
+			}
+			node.size = m.sizeOf(v)
+			m.memorySize += node.size
+			el = m.idList.PushBack(node)
 			m.idIndex[tableName][id] = el
+			m.evictOverMemory()
 		}
 		return v
 	} else {
@@ -154,6 +331,8 @@ func (m *LRUCacher) GetBean(tableName string, id string) interface{} {
 func (m *LRUCacher) clearIds(tableName string) {
 	if tis, ok := m.sqlIndex[tableName]; ok {
 		for sql, v := range tis {
+			m.memorySize -= v.Value.(*sqlNode).size
+			m.unlinkDeps(v.Value.(*sqlNode))
 			m.sqlList.Remove(v)
 			m.store.Del(sql)
 		}
@@ -170,12 +349,16 @@ func (m *LRUCacher) ClearIds(tableName string) {
 func (m *LRUCacher) clearBeans(tableName string) {
 	if tis, ok := m.idIndex[tableName]; ok {
 		for id, v := range tis {
+			m.memorySize -= v.Value.(*idNode).size
 			m.idList.Remove(v)
 			tid := genId(tableName, id)
 			m.store.Del(tid)
 		}
 	}
 	m.idIndex[tableName] = make(map[string]*list.Element)
+	if store, ok := m.store.(PrefixDeleter); ok {
+		store.DelPrefix(genId(tableName, ""))
+	}
 }
 
 func (m *LRUCacher) ClearBeans(tableName string) {
@@ -185,50 +368,73 @@ func (m *LRUCacher) ClearBeans(tableName string) {
 }
 
 func (m *LRUCacher) PutIds(tableName, sql string, ids interface{}) {
+	size := m.sizeOf(ids)
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 	if _, ok := m.sqlIndex[tableName]; !ok {
 		m.sqlIndex[tableName] = make(map[string]*list.Element)
 	}
+	var node *sqlNode
 	if el, ok := m.sqlIndex[tableName][sql]; !ok {
-		el = m.sqlList.PushBack(newSqlNode(tableName, sql))
+		node = newSqlNode(tableName, sql)
+		el = m.sqlList.PushBack(node)
 		m.sqlIndex[tableName][sql] = el
 	} else {
-		el.Value.(*sqlNode).lastVisit = time.Now()
+		node = el.Value.(*sqlNode)
+		node.lastVisit = time.Now()
+		node.stored = time.Now()
 	}
+	m.memorySize += size - node.size
+	node.size = size
 	m.store.Put(sql, ids)
 	if m.sqlList.Len() > m.MaxElementSize {
 		e := m.sqlList.Front()
 		node := e.Value.(*sqlNode)
+		m.tableStats(node.tbName).Evictions++
 		m.delIds(node.tbName, node.sql)
 	}
+	m.evictOverMemory()
 }
 
 func (m *LRUCacher) PutBean(tableName string, id string, obj interface{}) {
+	size := m.sizeOf(obj)
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 	var el *list.Element
 	var ok bool
 
+	if _, ok = m.idIndex[tableName]; !ok {
+		m.idIndex[tableName] = make(map[string]*list.Element)
+	}
+	var node *idNode
 	if el, ok = m.idIndex[tableName][id]; !ok {
-		el = m.idList.PushBack(newIdNode(tableName, id))
+		node = newIdNode(tableName, id)
+		el = m.idList.PushBack(node)
 		m.idIndex[tableName][id] = el
 	} else {
-		el.Value.(*idNode).lastVisit = time.Now()
+		node = el.Value.(*idNode)
+		node.lastVisit = time.Now()
+		node.stored = time.Now()
 	}
+	m.memorySize += size - node.size
+	node.size = size
 
 	m.store.Put(genId(tableName, id), obj)
 	if m.idList.Len() > m.MaxElementSize {
 		e := m.idList.Front()
 		node := e.Value.(*idNode)
+		m.tableStats(node.tbName).Evictions++
 		m.delBean(node.tbName, node.id)
 	}
+	m.evictOverMemory()
 }
 
 func (m *LRUCacher) delIds(tableName, sql string) {
 	if _, ok := m.sqlIndex[tableName]; ok {
 		if el, ok := m.sqlIndex[tableName][sql]; ok {
 			delete(m.sqlIndex[tableName], sql)
+			m.memorySize -= el.Value.(*sqlNode).size
+			m.unlinkDeps(el.Value.(*sqlNode))
 			m.sqlList.Remove(el)
 		}
 	}
@@ -241,10 +447,55 @@ func (m *LRUCacher) DelIds(tableName, sql string) {
 	m.delIds(tableName, sql)
 }
 
+// PutIdsDeps records that the ids cached for sql of tableName are also read
+// from the joined tables deps, so ClearDepIds of any of them clears the ids
+func (m *LRUCacher) PutIdsDeps(tableName, sql string, deps []string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	el, ok := m.sqlIndex[tableName][sql]
+	if !ok {
+		return
+	}
+	node := el.Value.(*sqlNode)
+	m.unlinkDeps(node)
+	node.deps = deps
+	if m.depIndex == nil {
+		m.depIndex = make(map[string]map[string]*list.Element)
+	}
+	for _, dep := range deps {
+		if _, ok := m.depIndex[dep]; !ok {
+			m.depIndex[dep] = make(map[string]*list.Element)
+		}
+		m.depIndex[dep][sql] = el
+	}
+}
+
+// ClearDepIds clears the ids of the other tables read from table depName
+func (m *LRUCacher) ClearDepIds(depName string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for _, el := range m.depIndex[depName] {
+		node := el.Value.(*sqlNode)
+		m.delIds(node.tbName, node.sql)
+	}
+}
+
+// unlinkDeps should be called with mutex locked
+func (m *LRUCacher) unlinkDeps(node *sqlNode) {
+	for _, dep := range node.deps {
+		delete(m.depIndex[dep], node.sql)
+		if len(m.depIndex[dep]) == 0 {
+			delete(m.depIndex, dep)
+		}
+	}
+	node.deps = nil
+}
+
 func (m *LRUCacher) delBean(tableName string, id string) {
 	tid := genId(tableName, id)
 	if el, ok := m.idIndex[tableName][id]; ok {
 		delete(m.idIndex[tableName], id)
+		m.memorySize -= el.Value.(*idNode).size
 		m.idList.Remove(el)
 		m.clearIds(tableName)
 	}
@@ -261,12 +512,17 @@ type idNode struct {
 	tbName    string
 	id        string
 	lastVisit time.Time
+	stored    time.Time
+	size      int64
 }
 
 type sqlNode struct {
 	tbName    string
 	sql       string
 	lastVisit time.Time
+	stored    time.Time
+	size      int64
+	deps      []string
 }
 
 func genSqlKey(sql string, args interface{}) string {
@@ -278,9 +534,87 @@ func genId(prefix string, id string) string {
 }
 
 func newIdNode(tbName string, id string) *idNode {
-	return &idNode{tbName, id, time.Now()}
+	now := time.Now()
+	return &idNode{tbName, id, now, now, 0}
 }
 
 func newSqlNode(tbName, sql string) *sqlNode {
-	return &sqlNode{tbName, sql, time.Now()}
+	now := time.Now()
+	return &sqlNode{tbName, sql, now, now, 0, nil}
+}
+
+// estimateSize returns the approximate bytes of v, including the memory it
+// refers to through pointers, strings, slices, maps and interfaces
+func estimateSize(v interface{}) int64 {
+	if v == nil {
+		return 0
+	}
+	rv := reflect.ValueOf(v)
+	return int64(rv.Type().Size()) + referredSize(rv, make(map[uintptr]bool))
+}
+
+// referredSize returns the bytes referred by v, out of v itself
+func referredSize(v reflect.Value, seen map[uintptr]bool) int64 {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() || seen[v.Pointer()] {
+			return 0
+		}
+		seen[v.Pointer()] = true
+		return int64(v.Type().Elem().Size()) + referredSize(v.Elem(), seen)
+	case reflect.Interface:
+		if v.IsNil() {
+			return 0
+		}
+		return int64(v.Elem().Type().Size()) + referredSize(v.Elem(), seen)
+	case reflect.String:
+		return int64(v.Len())
+	case reflect.Slice:
+		if v.IsNil() {
+			return 0
+		}
+		size := int64(v.Cap()) * int64(v.Type().Elem().Size())
+		if !isFlatKind(v.Type().Elem().Kind()) {
+			for i := 0; i < v.Len(); i++ {
+				size += referredSize(v.Index(i), seen)
+			}
+		}
+		return size
+	case reflect.Array:
+		var size int64
+		if !isFlatKind(v.Type().Elem().Kind()) {
+			for i := 0; i < v.Len(); i++ {
+				size += referredSize(v.Index(i), seen)
+			}
+		}
+		return size
+	case reflect.Map:
+		if v.IsNil() {
+			return 0
+		}
+		size := int64(v.Len()) * int64(v.Type().Key().Size()+v.Type().Elem().Size())
+		iter := v.MapRange()
+		for iter.Next() {
+			size += referredSize(iter.Key(), seen) + referredSize(iter.Value(), seen)
+		}
+		return size
+	case reflect.Struct:
+		var size int64
+		for i := 0; i < v.NumField(); i++ {
+			size += referredSize(v.Field(i), seen)
+		}
+		return size
+	}
+	return 0
+}
+
+// isFlatKind reports if a value of kind k refers no other memory
+func isFlatKind(k reflect.Kind) bool {
+	switch k {
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64, reflect.Complex64, reflect.Complex128:
+		return true
+	}
+	return false
 }
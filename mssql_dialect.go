@@ -1,6 +1,7 @@
 package xorm
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"strconv"
@@ -503,3 +504,189 @@ func (db *mssql) CreateTableSql(table *core.Table, tableName, storeEngine, chars
 func (db *mssql) Filters() []core.Filter {
 	return []core.Filter{&core.IdFilter{}, &core.QuoteFilter{}}
 }
+
+func (db *mssql) SavepointSql(name string) string {
+	return "SAVE TRANSACTION " + name
+}
+
+func (db *mssql) RollbackToSavepointSql(name string) string {
+	return "ROLLBACK TRANSACTION " + name
+}
+
+// mssql has no release of savepoint, it's released by the commit
+func (db *mssql) ReleaseSavepointSql(name string) string {
+	return ""
+}
+
+// PageSql pages by TOP for a limit only, by OFFSET and FETCH since 2012, or
+// by ROW_NUMBER
+func (db *mssql) PageSql(sqlStr, orderBy string, limit, offset int, legacy bool) string {
+	selectLen := len("SELECT ")
+	distinct := strings.HasPrefix(sqlStr, "SELECT DISTINCT ")
+	if distinct {
+		selectLen = len("SELECT DISTINCT ")
+	}
+
+	if offset == 0 {
+		sqlStr = fmt.Sprintf("%vTOP %d %v", sqlStr[:selectLen], limit, sqlStr[selectLen:])
+		if orderBy != "" {
+			sqlStr = fmt.Sprintf("%v ORDER BY %v", sqlStr, orderBy)
+		}
+		return sqlStr
+	}
+
+	// OFFSET and ROW_NUMBER need an order, even an undefined one
+	if orderBy == "" {
+		orderBy = "(SELECT NULL)"
+	}
+	if !legacy {
+		sqlStr = fmt.Sprintf("%v ORDER BY %v OFFSET %d ROWS", sqlStr, orderBy, offset)
+		if limit > 0 {
+			sqlStr = fmt.Sprintf("%v FETCH NEXT %d ROWS ONLY", sqlStr, limit)
+		}
+		return sqlStr
+	}
+
+	var inner string
+	if distinct {
+		// the row number would make every row distinct, so the rows are
+		// numbered out of the select, by the unqualified order columns
+		inner = fmt.Sprintf("SELECT xorm_t.*, ROW_NUMBER() OVER (ORDER BY %v) AS %v FROM (%v) xorm_t",
+			unqualifyOrderBy(orderBy), pagingRowNumColumn, sqlStr)
+	} else {
+		inner = fmt.Sprintf("%vROW_NUMBER() OVER (ORDER BY %v) AS %v, %v",
+			sqlStr[:selectLen], orderBy, pagingRowNumColumn, sqlStr[selectLen:])
+	}
+	cond := fmt.Sprintf("%v > %d", pagingRowNumColumn, offset)
+	if limit > 0 {
+		cond = fmt.Sprintf("%v AND %v <= %d", cond, pagingRowNumColumn, offset+limit)
+	}
+	return fmt.Sprintf("SELECT * FROM (%v) xorm_p WHERE %v ORDER BY %v", inner, cond, pagingRowNumColumn)
+}
+
+// selectTop returns the "TOP n " of the select clause selectStr paged by
+// PageSql, which is kept when its columns are replaced
+func selectTop(selectStr string) string {
+	fields := strings.Fields(selectStr)
+	i := 1
+	if i < len(fields) && strings.EqualFold(fields[i], "DISTINCT") {
+		i++
+	}
+	if i+1 < len(fields) && strings.EqualFold(fields[i], "TOP") {
+		return "TOP " + fields[i+1] + " "
+	}
+	return ""
+}
+
+// unqualifyOrderBy removes the table names of the columns of orderBy, also
+// in the functions of its items
+func unqualifyOrderBy(orderBy string) string {
+	items := splitOrderBy(orderBy)
+	for i, item := range items {
+		items[i] = unqualifyColumns(strings.TrimSpace(item))
+	}
+	return strings.Join(items, ", ")
+}
+
+// splitOrderBy splits orderBy on the commas out of parentheses and quotes
+func splitOrderBy(orderBy string) []string {
+	var items []string
+	var quote byte
+	depth, start := 0, 0
+	for i := 0; i < len(orderBy); i++ {
+		c := orderBy[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '[':
+			quote = ']'
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case c == ',' && depth == 0:
+			items = append(items, orderBy[start:i])
+			start = i + 1
+		}
+	}
+	return append(items, orderBy[start:])
+}
+
+// unqualifyColumns removes the names before the dots of the identifiers of
+// expr, the strings and numbers are kept
+func unqualifyColumns(expr string) string {
+	var buf bytes.Buffer
+	for i := 0; i < len(expr); {
+		j := endOfToken(expr, i)
+		if j == i {
+			j = i + 1
+		} else if j < len(expr) && expr[j] == '.' && isQualifier(expr[i]) {
+			i = j + 1
+			continue
+		}
+		buf.WriteString(expr[i:j])
+		i = j
+	}
+	return buf.String()
+}
+
+// endOfToken returns the end of the identifier, quoted name or string of
+// expr starting at i, i if there's none
+func endOfToken(expr string, i int) int {
+	switch c := expr[i]; {
+	case c == '[' || c == '"' || c == '\'':
+		end := c
+		if c == '[' {
+			end = ']'
+		}
+		if j := strings.IndexByte(expr[i+1:], end); j != -1 {
+			return i + j + 2
+		}
+		return len(expr)
+	case isIdentChar(c):
+		j := i + 1
+		for j < len(expr) && isIdentChar(expr[j]) {
+			j++
+		}
+		return j
+	}
+	return i
+}
+
+func isIdentChar(c byte) bool {
+	return c == '_' || c == '$' || c == '#' || c >= '0' && c <= '9' ||
+		c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+}
+
+// isQualifier reports if a token starting by c could be a table name, not
+// a number or a string
+func isQualifier(c byte) bool {
+	return c != '\'' && (c < '0' || c > '9')
+}
+
+func (db *mssql) ClassifyError(err error) error {
+	number, _ := driverErrorCode(err)
+	msg := errorMessage(err)
+	switch number {
+	case 2627, 2601: // unique constraint, unique index
+		return ErrDuplicateKey
+	case 547: // constraint conflict, also raised by the check constraints
+		if strings.Contains(msg, "foreign key") || strings.Contains(msg, "reference constraint") {
+			return ErrForeignKeyViolation
+		}
+	case 515: // cannot insert null
+		return ErrNotNullViolation
+	case 1205: // chosen as deadlock victim
+		return ErrDeadlock
+	case 3960: // snapshot isolation update conflict
+		return ErrSerialization
+	}
+	if strings.Contains(msg, "deadlock victim") {
+		return ErrDeadlock
+	}
+	return nil
+}
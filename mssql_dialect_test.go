@@ -0,0 +1,90 @@
+package xorm
+
+import (
+	"testing"
+)
+
+func TestMssqlPageSql(t *testing.T) {
+	const (
+		sqlStr   = "SELECT [id], [name] FROM [user] WHERE [age] > ?"
+		distinct = "SELECT DISTINCT [name] FROM [user] u"
+	)
+
+	var tests = []struct {
+		sqlStr, orderBy string
+		limit, offset   int
+		legacy          bool
+		want            string
+	}{
+		{sqlStr, "", 10, 0, false,
+			"SELECT TOP 10 [id], [name] FROM [user] WHERE [age] > ?"},
+		{distinct, "[name]", 10, 0, false,
+			"SELECT DISTINCT TOP 10 [name] FROM [user] u ORDER BY [name]"},
+		{sqlStr, "[user].[name] DESC", 10, 20, false,
+			"SELECT [id], [name] FROM [user] WHERE [age] > ? ORDER BY [user].[name] DESC OFFSET 20 ROWS FETCH NEXT 10 ROWS ONLY"},
+		{sqlStr, "", 0, 20, false,
+			"SELECT [id], [name] FROM [user] WHERE [age] > ? ORDER BY (SELECT NULL) OFFSET 20 ROWS"},
+		{sqlStr, "", 10, 0, true,
+			"SELECT TOP 10 [id], [name] FROM [user] WHERE [age] > ?"},
+		{sqlStr, "[user].[name] DESC", 10, 20, true,
+			"SELECT * FROM (SELECT ROW_NUMBER() OVER (ORDER BY [user].[name] DESC) AS xorm_rn, [id], [name] FROM [user] WHERE [age] > ?) xorm_p WHERE xorm_rn > 20 AND xorm_rn <= 30 ORDER BY xorm_rn"},
+		{sqlStr, "", 0, 20, true,
+			"SELECT * FROM (SELECT ROW_NUMBER() OVER (ORDER BY (SELECT NULL)) AS xorm_rn, [id], [name] FROM [user] WHERE [age] > ?) xorm_p WHERE xorm_rn > 20 ORDER BY xorm_rn"},
+		{distinct, "[u].[name] DESC", 10, 20, true,
+			"SELECT * FROM (SELECT xorm_t.*, ROW_NUMBER() OVER (ORDER BY [name] DESC) AS xorm_rn FROM (SELECT DISTINCT [name] FROM [user] u) xorm_t) xorm_p WHERE xorm_rn > 20 AND xorm_rn <= 30 ORDER BY xorm_rn"},
+	}
+
+	db := &mssql{}
+	for _, test := range tests {
+		got := db.PageSql(test.sqlStr, test.orderBy, test.limit, test.offset, test.legacy)
+		if got != test.want {
+			t.Errorf("%q %q %d %d %v:\n got %v\nwant %v", test.sqlStr, test.orderBy, test.limit, test.offset, test.legacy, got, test.want)
+		}
+	}
+}
+
+func TestUnqualifyOrderBy(t *testing.T) {
+	var tests = []struct {
+		orderBy, want string
+	}{
+		{"name", "name"},
+		{"[u].[name] DESC, id", "[name] DESC, id"},
+		{`"u"."name" ASC`, `"name" ASC`},
+		{"dbo.u.name", "name"},
+		{"COALESCE(u.a, u.b) DESC, u.id", "COALESCE(a, b) DESC, id"},
+		{"CONVERT(varchar(10), t.d, 120)", "CONVERT(varchar(10), d, 120)"},
+		{"t.a * 1.5, 'x.y, z'", "a * 1.5, 'x.y, z'"},
+	}
+
+	for _, test := range tests {
+		if got := unqualifyOrderBy(test.orderBy); got != test.want {
+			t.Errorf("%q: got %q, want %q", test.orderBy, got, test.want)
+		}
+	}
+}
+
+func TestMssqlConvertIdSql(t *testing.T) {
+	const sqlStr = `SELECT "id", "name" FROM "user" WHERE "age" > ?`
+
+	var tests = []struct {
+		limit, offset int
+		legacy        bool
+		want          string
+	}{
+		{1, 0, false,
+			`SELECT TOP 1 "user"."id" FROM  "user" WHERE "age" > ? ORDER BY "name"`},
+		{10, 20, false,
+			`SELECT "user"."id" FROM  "user" WHERE "age" > ? ORDER BY "name" OFFSET 20 ROWS FETCH NEXT 10 ROWS ONLY`},
+		{10, 20, true,
+			`SELECT "id" FROM  (SELECT ROW_NUMBER() OVER (ORDER BY "name") AS xorm_rn, "id", "name" FROM "user" WHERE "age" > ?) xorm_p WHERE xorm_rn > 20 AND xorm_rn <= 30 ORDER BY xorm_rn`},
+	}
+
+	db := &mssql{}
+	statement := newTestPagingStatement(db)
+	for _, test := range tests {
+		paged := db.PageSql(sqlStr, `"name"`, test.limit, test.offset, test.legacy)
+		if got := statement.convertIdSql(paged); got != test.want {
+			t.Errorf("%d %d %v:\n got %v\nwant %v", test.limit, test.offset, test.legacy, got, test.want)
+		}
+	}
+}
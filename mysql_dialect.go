@@ -475,3 +475,27 @@ func (db *mysql) GetIndexes(tableName string) (map[string]*core.Index, error) {
 func (db *mysql) Filters() []core.Filter {
 	return []core.Filter{&core.IdFilter{}}
 }
+
+func (db *mysql) ClassifyError(err error) error {
+	number, _ := driverErrorCode(err)
+	switch number {
+	case 1062, 1586: // ER_DUP_ENTRY, ER_DUP_ENTRY_WITH_KEY_NAME
+		return ErrDuplicateKey
+	case 1216, 1217, 1451, 1452: // ER_NO_REFERENCED_ROW, ER_ROW_IS_REFERENCED
+		return ErrForeignKeyViolation
+	case 1048, 1364: // ER_BAD_NULL_ERROR, ER_NO_DEFAULT_FOR_FIELD
+		return ErrNotNullViolation
+	case 1213: // ER_LOCK_DEADLOCK
+		return ErrDeadlock
+	case 1205: // ER_LOCK_WAIT_TIMEOUT
+		return ErrLockTimeout
+	}
+	msg := errorMessage(err)
+	switch {
+	case strings.Contains(msg, "deadlock found"):
+		return ErrDeadlock
+	case strings.Contains(msg, "invalid connection"): // mysql.ErrInvalidConn
+		return ErrConnection
+	}
+	return nil
+}
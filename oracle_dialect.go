@@ -735,3 +735,63 @@ func (db *oracle) GetIndexes(tableName string) (map[string]*core.Index, error) {
 func (db *oracle) Filters() []core.Filter {
 	return []core.Filter{&core.QuoteFilter{}, &core.SeqFilter{":", 1}, &core.IdFilter{}}
 }
+
+func (db *oracle) SavepointSql(name string) string {
+	return "SAVEPOINT " + name
+}
+
+func (db *oracle) RollbackToSavepointSql(name string) string {
+	return "ROLLBACK TO SAVEPOINT " + name
+}
+
+// oracle has no release of savepoint, it's released by the commit
+func (db *oracle) ReleaseSavepointSql(name string) string {
+	return ""
+}
+
+// PageSql pages by OFFSET and FETCH since 12c, or by ROWNUM
+func (db *oracle) PageSql(sqlStr, orderBy string, limit, offset int, legacy bool) string {
+	if orderBy != "" {
+		sqlStr = fmt.Sprintf("%v ORDER BY %v", sqlStr, orderBy)
+	}
+	if !legacy {
+		if offset > 0 {
+			sqlStr = fmt.Sprintf("%v OFFSET %d ROWS", sqlStr, offset)
+		}
+		if limit > 0 {
+			sqlStr = fmt.Sprintf("%v FETCH NEXT %d ROWS ONLY", sqlStr, limit)
+		}
+		return sqlStr
+	}
+
+	if offset == 0 {
+		return fmt.Sprintf("SELECT * FROM (%v) WHERE ROWNUM <= %d", sqlStr, limit)
+	}
+	// ROWNUM is given before the outer condition, so it's renamed inside
+	inner := fmt.Sprintf("SELECT xorm_t.*, ROWNUM %v FROM (%v) xorm_t", pagingRowNumColumn, sqlStr)
+	if limit > 0 {
+		inner = fmt.Sprintf("%v WHERE ROWNUM <= %d", inner, offset+limit)
+	}
+	return fmt.Sprintf("SELECT * FROM (%v) WHERE %v > %d", inner, pagingRowNumColumn, offset)
+}
+
+// the oracle drivers have no error code field, the ORA- code is in the
+// message
+func (db *oracle) ClassifyError(err error) error {
+	msg := errorMessage(err)
+	switch {
+	case strings.Contains(msg, "ora-00001"): // unique constraint violated
+		return ErrDuplicateKey
+	case strings.Contains(msg, "ora-02291") || strings.Contains(msg, "ora-02292"):
+		return ErrForeignKeyViolation
+	case strings.Contains(msg, "ora-01400"): // cannot insert null
+		return ErrNotNullViolation
+	case strings.Contains(msg, "ora-00060"):
+		return ErrDeadlock
+	case strings.Contains(msg, "ora-08177"): // can't serialize access
+		return ErrSerialization
+	case strings.Contains(msg, "ora-03113") || strings.Contains(msg, "ora-03114") || strings.Contains(msg, "ora-12541"):
+		return ErrConnection
+	}
+	return nil
+}
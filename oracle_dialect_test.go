@@ -0,0 +1,71 @@
+package xorm
+
+import (
+	"testing"
+
+	"github.com/go-xorm/core"
+)
+
+func TestOraclePageSql(t *testing.T) {
+	const sqlStr = `SELECT "id", "name" FROM "user" WHERE "age" > ?`
+
+	var tests = []struct {
+		orderBy       string
+		limit, offset int
+		legacy        bool
+		want          string
+	}{
+		{`"name"`, 10, 0, false,
+			`SELECT "id", "name" FROM "user" WHERE "age" > ? ORDER BY "name" FETCH NEXT 10 ROWS ONLY`},
+		{`"name"`, 10, 20, false,
+			`SELECT "id", "name" FROM "user" WHERE "age" > ? ORDER BY "name" OFFSET 20 ROWS FETCH NEXT 10 ROWS ONLY`},
+		{"", 0, 20, false,
+			`SELECT "id", "name" FROM "user" WHERE "age" > ? OFFSET 20 ROWS`},
+		{`"name"`, 10, 0, true,
+			`SELECT * FROM (SELECT "id", "name" FROM "user" WHERE "age" > ? ORDER BY "name") WHERE ROWNUM <= 10`},
+		{`"name"`, 10, 20, true,
+			`SELECT * FROM (SELECT xorm_t.*, ROWNUM xorm_rn FROM (SELECT "id", "name" FROM "user" WHERE "age" > ? ORDER BY "name") xorm_t WHERE ROWNUM <= 30) WHERE xorm_rn > 20`},
+		{"", 0, 20, true,
+			`SELECT * FROM (SELECT xorm_t.*, ROWNUM xorm_rn FROM (SELECT "id", "name" FROM "user" WHERE "age" > ?) xorm_t) WHERE xorm_rn > 20`},
+	}
+
+	db := &oracle{}
+	for _, test := range tests {
+		if got := db.PageSql(sqlStr, test.orderBy, test.limit, test.offset, test.legacy); got != test.want {
+			t.Errorf("%q %d %d %v:\n got %v\nwant %v", test.orderBy, test.limit, test.offset, test.legacy, got, test.want)
+		}
+	}
+}
+
+func newTestPagingStatement(dialect core.Dialect) *Statement {
+	table := core.NewEmptyTable()
+	table.Name = "user"
+	table.PrimaryKeys = []string{"id"}
+	return &Statement{Engine: &Engine{dialect: dialect}, RefTable: table}
+}
+
+func TestOracleConvertIdSql(t *testing.T) {
+	const sqlStr = `SELECT "id", "name" FROM "user" WHERE "age" > ?`
+
+	var tests = []struct {
+		limit, offset int
+		legacy        bool
+		want          string
+	}{
+		{10, 20, false,
+			`SELECT "user"."id" FROM  "user" WHERE "age" > ? ORDER BY "name" OFFSET 20 ROWS FETCH NEXT 10 ROWS ONLY`},
+		{10, 0, true,
+			`SELECT "id" FROM  (SELECT "id", "name" FROM "user" WHERE "age" > ? ORDER BY "name") WHERE ROWNUM <= 10`},
+		{10, 20, true,
+			`SELECT "id" FROM  (SELECT xorm_t.*, ROWNUM xorm_rn FROM (SELECT "id", "name" FROM "user" WHERE "age" > ? ORDER BY "name") xorm_t WHERE ROWNUM <= 30) WHERE xorm_rn > 20`},
+	}
+
+	db := &oracle{}
+	statement := newTestPagingStatement(db)
+	for _, test := range tests {
+		paged := db.PageSql(sqlStr, `"name"`, test.limit, test.offset, test.legacy)
+		if got := statement.convertIdSql(paged); got != test.want {
+			t.Errorf("%d %d %v:\n got %v\nwant %v", test.limit, test.offset, test.legacy, got, test.want)
+		}
+	}
+}
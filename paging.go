@@ -0,0 +1,32 @@
+package xorm
+
+import (
+	"strings"
+)
+
+// PagingDialect is implemented by the dialects which don't page a select by
+// LIMIT and OFFSET. PageSql returns sqlStr, a select without ORDER BY,
+// ordered by orderBy if it's not "" and limited to limit rows, 0 for no
+// limit, from offset. legacy is set by Engine.SetLegacyPaging for the
+// database versions without the standard OFFSET and FETCH.
+type PagingDialect interface {
+	PageSql(sqlStr, orderBy string, limit, offset int, legacy bool) string
+}
+
+// pagingRowNumColumn is the row number column added to the results by the
+// legacy paging, which isn't mapped to the beans
+const pagingRowNumColumn = "xorm_rn"
+
+func isPagingColumn(name string) bool {
+	return strings.EqualFold(name, pagingRowNumColumn)
+}
+
+// SetLegacyPaging makes the dialects page the selects for the old database
+// versions, like ROWNUM for Oracle before 12c or ROW_NUMBER for SQL Server
+// before 2012. It's engine-wide, every PagingDialect gets it, so it should
+// only be set for one of these old versions. A paged join selecting * only
+// gets the columns of the statement's table, as the numbered rows couldn't
+// have the same column twice.
+func (engine *Engine) SetLegacyPaging(legacy bool) {
+	engine.legacyPaging = legacy
+}
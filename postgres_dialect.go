@@ -643,3 +643,29 @@ func (db *postgres) GetIndexes(tableName string) (map[string]*core.Index, error)
 func (db *postgres) Filters() []core.Filter {
 	return []core.Filter{&core.IdFilter{}, &core.QuoteFilter{}, &core.SeqFilter{"$", 1}}
 }
+
+func (db *postgres) ClassifyError(err error) error {
+	_, code := driverErrorCode(err)
+	switch {
+	case code == "23505": // unique_violation
+		return ErrDuplicateKey
+	case code == "23503": // foreign_key_violation
+		return ErrForeignKeyViolation
+	case code == "23502": // not_null_violation
+		return ErrNotNullViolation
+	case code == "40P01": // deadlock_detected
+		return ErrDeadlock
+	case code == "40001": // serialization_failure
+		return ErrSerialization
+	case strings.HasPrefix(code, "08"): // connection exception
+		return ErrConnection
+	}
+	msg := errorMessage(err)
+	switch {
+	case strings.Contains(msg, "deadlock detected"):
+		return ErrDeadlock
+	case strings.Contains(msg, "could not serialize access"):
+		return ErrSerialization
+	}
+	return nil
+}
@@ -15,16 +15,32 @@ type BeforeDeleteProcessor interface {
 	BeforeDelete()
 }
 
+// Executed before an object is inserted, with the session doing it, which
+// could run sql in the same transaction. A returned error aborts the insert.
+type BeforeInsertSessionProcessor interface {
+	BeforeInsert(*Session) error
+}
+
+// Executed before an object is updated, with the session doing it, which
+// could run sql in the same transaction. A returned error aborts the update.
+type BeforeUpdateSessionProcessor interface {
+	BeforeUpdate(*Session) error
+}
+
+// Executed before an object is deleted, with the session doing it, which
+// could run sql in the same transaction. A returned error aborts the delete.
+type BeforeDeleteSessionProcessor interface {
+	BeforeDelete(*Session) error
+}
+
 type BeforeSetProcessor interface {
 	BeforeSet(string, Cell)
 }
 
-// !nashtsai! TODO enable BeforeValidateProcessor when xorm start to support validations
-//// Executed before an object is validated
-//type BeforeValidateProcessor interface {
-//    BeforeValidate()
-//}
-// --
+// Executed before an object is validated
+type BeforeValidateProcessor interface {
+	BeforeValidate()
+}
 
 // Executed after an object is persisted to the database
 type AfterInsertProcessor interface {
@@ -40,3 +56,9 @@ type AfterUpdateProcessor interface {
 type AfterDeleteProcessor interface {
 	AfterDelete()
 }
+
+// Executed after the transaction in which an object was inserted, updated
+// or deleted has been rolled back
+type AfterRollbackProcessor interface {
+	AfterRollback()
+}
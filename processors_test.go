@@ -0,0 +1,33 @@
+package xorm
+
+import (
+	"testing"
+)
+
+type sessionProcessorBean struct {
+	Id   int64
+	Name string
+	Age  int
+}
+
+// BeforeUpdate changes the columns and conditions of the session, which
+// should not change the update being run
+func (bean *sessionProcessorBean) BeforeUpdate(session *Session) error {
+	session.Cols("age").In("id", 5, 6).Incr("age")
+	return nil
+}
+
+func TestSessionProcessorStatement(t *testing.T) {
+	engine, db := newTestEngine(t)
+	if _, err := engine.Id(1).Update(&sessionProcessorBean{Name: "a", Age: 2}); err != nil {
+		t.Fatal(err)
+	}
+
+	sqls := db.executed()
+	if len(sqls) != 1 {
+		t.Fatalf("executed %q, want one update", sqls)
+	}
+	if want := "UPDATE `session_processor_bean` SET `name` = ?, `age` = ? WHERE `id` = ?"; sqls[0] != want {
+		t.Errorf("executed %q, want %q", sqls[0], want)
+	}
+}
@@ -0,0 +1,240 @@
+package xorm
+
+import (
+	"container/list"
+	"reflect"
+	"sync"
+	"time"
+)
+
+const (
+	// default max results kept by the raw query cache
+	DEFAULT_QUERY_CACHE_SIZE = 1000
+)
+
+type queryCacheEntry struct {
+	key     string
+	value   interface{}
+	expired time.Time
+	tables  []string
+}
+
+// queryCache keeps the results of the queries run with CacheFor in LRU
+// order, an entry is dropped when its ttl elapsed or one of its declared
+// tables is written.
+type queryCache struct {
+	mutex   sync.Mutex
+	list    *list.List
+	index   map[string]*list.Element
+	tables  map[string]map[string]*list.Element
+	maxSize int
+}
+
+func newQueryCache(maxSize int) *queryCache {
+	return &queryCache{
+		list:    list.New(),
+		index:   make(map[string]*list.Element),
+		tables:  make(map[string]map[string]*list.Element),
+		maxSize: maxSize,
+	}
+}
+
+func (c *queryCache) get(key string) interface{} {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	el, ok := c.index[key]
+	if !ok {
+		return nil
+	}
+	entry := el.Value.(*queryCacheEntry)
+	if time.Now().After(entry.expired) {
+		c.remove(el)
+		return nil
+	}
+	c.list.MoveToBack(el)
+	return entry.value
+}
+
+func (c *queryCache) put(key string, value interface{}, ttl time.Duration, tables []string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if el, ok := c.index[key]; ok {
+		c.remove(el)
+	}
+	entry := &queryCacheEntry{key: key, value: value, expired: time.Now().Add(ttl), tables: tables}
+	el := c.list.PushBack(entry)
+	c.index[key] = el
+	for _, table := range tables {
+		if _, ok := c.tables[table]; !ok {
+			c.tables[table] = make(map[string]*list.Element)
+		}
+		c.tables[table][key] = el
+	}
+	for c.list.Len() > c.maxSize {
+		c.remove(c.list.Front())
+	}
+}
+
+// remove should be called with mutex locked
+func (c *queryCache) remove(el *list.Element) {
+	entry := el.Value.(*queryCacheEntry)
+	c.list.Remove(el)
+	delete(c.index, entry.key)
+	for _, table := range entry.tables {
+		delete(c.tables[table], entry.key)
+		if len(c.tables[table]) == 0 {
+			delete(c.tables, table)
+		}
+	}
+}
+
+// invalidate drops all the results depending on tableName
+func (c *queryCache) invalidate(tableName string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for _, el := range c.tables[tableName] {
+		c.remove(el)
+	}
+}
+
+func (c *queryCache) setMaxSize(maxSize int) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.maxSize = maxSize
+	for c.list.Len() > c.maxSize {
+		c.remove(c.list.Front())
+	}
+}
+
+// SetQueryCacheSize set the max results kept for the queries run with CacheFor
+func (engine *Engine) SetQueryCacheSize(size int) {
+	engine.queryCache.setMaxSize(size)
+}
+
+// invalidateDependents drops the cached query results and joined id lists
+// depending on tableName. In a transaction they are dropped again after
+// commit, since other sessions may have cached the old results meanwhile.
+func (session *Session) invalidateDependents(tableName string) {
+	session.Engine.clearDependents(tableName)
+	if !session.IsAutoCommit {
+		session.txTables = append(session.txTables, tableName)
+	}
+}
+
+// useQueryCache reports if the results of the statement are cached, the
+// uncommitted data read in a transaction are not shared with other sessions
+func (session *Session) useQueryCache() bool {
+	return session.Statement.cacheTTL > 0 && session.IsAutoCommit
+}
+
+// queryCacheTables returns the tables a cached result of table depends on
+func (session *Session) queryCacheTables(table string) []string {
+	tables := make([]string, 0, len(session.Statement.cacheTables)+1)
+	tables = append(tables, session.Statement.cacheTables...)
+	if table != "" {
+		tables = append(tables, table)
+	}
+	return tables
+}
+
+func copyBytesMaps(results []map[string][]byte) []map[string][]byte {
+	copied := make([]map[string][]byte, 0, len(results))
+	for _, result := range results {
+		m := make(map[string][]byte, len(result))
+		for k, v := range result {
+			m[k] = append([]byte(nil), v...)
+		}
+		copied = append(copied, m)
+	}
+	return copied
+}
+
+func copyStringMaps(results []map[string]string) []map[string]string {
+	copied := make([]map[string]string, 0, len(results))
+	for _, result := range results {
+		m := make(map[string]string, len(result))
+		for k, v := range result {
+			m[k] = v
+		}
+		copied = append(copied, m)
+	}
+	return copied
+}
+
+// copyFindResults deep copies the elements Find added to a slice after
+// from, or all the entries of a map
+func copyFindResults(sliceValue reflect.Value, from int) reflect.Value {
+	if sliceValue.Kind() == reflect.Map {
+		return deepCopy(sliceValue)
+	}
+	return deepCopy(sliceValue.Slice(from, sliceValue.Len()))
+}
+
+// deepCopy returns a copy of v sharing no pointed value, slice or map with
+// it, but the ones in unexported fields
+func deepCopy(v reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return v
+		}
+		copied := reflect.New(v.Type().Elem())
+		copied.Elem().Set(deepCopy(v.Elem()))
+		return copied
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		copied := reflect.New(v.Type()).Elem()
+		copied.Set(deepCopy(v.Elem()))
+		return copied
+	case reflect.Struct:
+		copied := reflect.New(v.Type()).Elem()
+		copied.Set(v)
+		for i := 0; i < copied.NumField(); i++ {
+			if field := copied.Field(i); field.CanSet() {
+				field.Set(deepCopy(v.Field(i)))
+			}
+		}
+		return copied
+	case reflect.Array:
+		copied := reflect.New(v.Type()).Elem()
+		for i := 0; i < v.Len(); i++ {
+			copied.Index(i).Set(deepCopy(v.Index(i)))
+		}
+		return copied
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		copied := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			copied.Index(i).Set(deepCopy(v.Index(i)))
+		}
+		return copied
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		copied := reflect.MakeMapWithSize(v.Type(), v.Len())
+		for _, key := range v.MapKeys() {
+			copied.SetMapIndex(key, deepCopy(v.MapIndex(key)))
+		}
+		return copied
+	}
+	return v
+}
+
+// appendFindResults adds the cached results to the slice or map of Find
+func appendFindResults(sliceValue reflect.Value, cached reflect.Value) {
+	if sliceValue.Kind() == reflect.Map {
+		if sliceValue.IsNil() {
+			sliceValue.Set(reflect.MakeMap(sliceValue.Type()))
+		}
+		for _, key := range cached.MapKeys() {
+			sliceValue.SetMapIndex(key, cached.MapIndex(key))
+		}
+		return
+	}
+	sliceValue.Set(reflect.AppendSlice(sliceValue, cached))
+}
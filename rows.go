@@ -46,16 +46,16 @@ func newRows(session *Session, bean interface{}) (*Rows, error) {
 		sqlStr = filter.Do(sqlStr, session.Engine.dialect, rows.session.Statement.RefTable)
 	}
 
-	rows.session.Engine.logSQL(sqlStr, args)
+	rows.session.logSQL(sqlStr, args)
 
-	rows.stmt, err = rows.session.Db.Prepare(sqlStr)
-	if err != nil {
-		rows.lastError = err
-		defer rows.Close()
-		return nil, err
+	hookCtx, err := rows.session.beforeProcess(sqlStr, args, true)
+	if err == nil {
+		rows.stmt, err = rows.session.Db.Prepare(sqlStr)
+		if err == nil {
+			rows.rows, err = rows.stmt.Query(args...)
+		}
 	}
-
-	rows.rows, err = rows.stmt.Query(args...)
+	err = rows.session.afterProcess(hookCtx, nil, err)
 	if err != nil {
 		rows.lastError = err
 		defer rows.Close()
@@ -79,6 +79,8 @@ func (rows *Rows) Next() bool {
 		hasNext := rows.rows.Next()
 		if !hasNext {
 			rows.lastError = sql.ErrNoRows
+		} else {
+			rows.session.countRows(1)
 		}
 		return hasNext
 	}
@@ -0,0 +1,137 @@
+package xorm
+
+import (
+	"fmt"
+)
+
+// SavepointDialect is implemented by the dialects which don't use the
+// standard SAVEPOINT, ROLLBACK TO SAVEPOINT and RELEASE SAVEPOINT statements
+// for the nested transactions. ReleaseSavepointSql returns "" if the dialect
+// could not release a savepoint.
+type SavepointDialect interface {
+	SavepointSql(name string) string
+	RollbackToSavepointSql(name string) string
+	ReleaseSavepointSql(name string) string
+}
+
+// savepoint is a nested transaction level, with the processors registered
+// before it began
+type savepoint struct {
+	name             string
+	afterInsertBeans map[interface{}]*[]func(interface{})
+	afterUpdateBeans map[interface{}]*[]func(interface{})
+	afterDeleteBeans map[interface{}]*[]func(interface{})
+	// AfterRollbackProcessor beans written since it began
+	beans map[interface{}]bool
+	// lengths of the session's OnCommit and OnRollback funcs
+	onCommitLen   int
+	onRollbackLen int
+}
+
+func copyBeanClosures(beans map[interface{}]*[]func(interface{})) map[interface{}]*[]func(interface{}) {
+	copied := make(map[interface{}]*[]func(interface{}), len(beans))
+	for bean, closuresPtr := range beans {
+		if closuresPtr == nil {
+			copied[bean] = nil
+			continue
+		}
+		closures := make([]func(interface{}), len(*closuresPtr))
+		copy(closures, *closuresPtr)
+		copied[bean] = &closures
+	}
+	return copied
+}
+
+// markSavepointBean records a bean written in the innermost savepoint, so
+// it gets its AfterRollback even if it was already written before it
+func (session *Session) markSavepointBean(bean interface{}) {
+	if len(session.savepoints) == 0 {
+		return
+	}
+	if _, ok := bean.(AfterRollbackProcessor); ok {
+		session.savepoints[len(session.savepoints)-1].beans[bean] = true
+	}
+}
+
+func (session *Session) savepointSql(name string) string {
+	if dialect, ok := session.Engine.dialect.(SavepointDialect); ok {
+		return dialect.SavepointSql(name)
+	}
+	return "SAVEPOINT " + name
+}
+
+func (session *Session) rollbackToSavepointSql(name string) string {
+	if dialect, ok := session.Engine.dialect.(SavepointDialect); ok {
+		return dialect.RollbackToSavepointSql(name)
+	}
+	return "ROLLBACK TO SAVEPOINT " + name
+}
+
+func (session *Session) releaseSavepointSql(name string) string {
+	if dialect, ok := session.Engine.dialect.(SavepointDialect); ok {
+		return dialect.ReleaseSavepointSql(name)
+	}
+	return "RELEASE SAVEPOINT " + name
+}
+
+// beginSavepoint starts a nested transaction in the opened one
+func (session *Session) beginSavepoint() error {
+	sp := &savepoint{
+		name:             fmt.Sprintf("xorm_sp_%d", len(session.savepoints)+1),
+		afterInsertBeans: copyBeanClosures(session.afterInsertBeans),
+		afterUpdateBeans: copyBeanClosures(session.afterUpdateBeans),
+		afterDeleteBeans: copyBeanClosures(session.afterDeleteBeans),
+		beans:            make(map[interface{}]bool),
+		onCommitLen:      len(session.onCommit),
+		onRollbackLen:    len(session.onRollback),
+	}
+	if _, err := session.exec(session.savepointSql(sp.name)); err != nil {
+		return err
+	}
+	session.savepoints = append(session.savepoints, sp)
+	return nil
+}
+
+// rollbackSavepoint undoes the innermost nested transaction, drops the after
+// processors and OnCommit funcs registered in it and runs its OnRollback
+// funcs and AfterRollback processors. The savepoint is kept if it could not
+// be rolled back, so the caller can still retry or roll back the outer one.
+func (session *Session) rollbackSavepoint() error {
+	sp := session.savepoints[len(session.savepoints)-1]
+	if _, err := session.exec(session.rollbackToSavepointSql(sp.name)); err != nil {
+		return err
+	}
+	session.savepoints = session.savepoints[:len(session.savepoints)-1]
+	session.afterInsertBeans = sp.afterInsertBeans
+	session.afterUpdateBeans = sp.afterUpdateBeans
+	session.afterDeleteBeans = sp.afterDeleteBeans
+
+	onRollback := session.onRollback[sp.onRollbackLen:]
+	session.onCommit = session.onCommit[:sp.onCommitLen]
+	session.onRollback = session.onRollback[:sp.onRollbackLen:sp.onRollbackLen]
+	callAfterRollback(sp.beans)
+	for _, fn := range onRollback {
+		fn()
+	}
+	return nil
+}
+
+// commitSavepoint ends the innermost nested transaction, its changes and
+// after processors are kept until the outermost transaction commits
+func (session *Session) commitSavepoint() error {
+	sp := session.savepoints[len(session.savepoints)-1]
+	if sqlStr := session.releaseSavepointSql(sp.name); sqlStr != "" {
+		if _, err := session.exec(sqlStr); err != nil {
+			return err
+		}
+	}
+	session.savepoints = session.savepoints[:len(session.savepoints)-1]
+	// its changes are now rolled back with the enclosing savepoint
+	if len(session.savepoints) > 0 {
+		outer := session.savepoints[len(session.savepoints)-1]
+		for bean := range sp.beans {
+			outer.beans[bean] = true
+		}
+	}
+	return nil
+}
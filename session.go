@@ -1,11 +1,11 @@
 package xorm
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"hash/crc32"
 	"reflect"
 	"strconv"
 	"strings"
@@ -39,8 +39,30 @@ type Session struct {
 	beforeClosures []func(interface{})
 	afterClosures  []func(interface{})
 
-	stmtCache   map[uint32]*core.Stmt //key: hash.Hash32 of (queryStr, len(queryStr))
+	// cache invalidations to broadcast after tx committed
+	invalidations []CacheInvalidation
+	// tables written in tx, whose cached query results are dropped after commit
+	txTables []string
+	// nested transactions in tx, the innermost last
+	savepoints []*savepoint
+	// funcs called after the tx is committed or rolled back
+	onCommit   []func()
+	onRollback []func()
+	// connection of a tx begun by BeginTx whose options last on it, and the
+	// sqls restoring them after the tx ended
+	txConn      *sql.Conn
+	txResetSqls []string
+
 	cascadeDeep int
+
+	// unique id of the session in the process, reported in SQL log events
+	id int64
+	// context passed to the hooks
+	ctx context.Context
+	// operation type and table of the last sql, which the scanned rows are
+	// counted to
+	lastOp    string
+	lastTable string
 }
 
 // Method Init reset the session as the init status.
@@ -58,19 +80,20 @@ func (session *Session) Init() {
 	session.afterDeleteBeans = make(map[interface{}]*[]func(interface{}), 0)
 	session.beforeClosures = make([]func(interface{}), 0)
 	session.afterClosures = make([]func(interface{}), 0)
+	session.invalidations = nil
+	session.txTables = nil
+	session.savepoints = nil
+	session.onCommit = nil
+	session.onRollback = nil
 }
 
 // Method Close release the connection from pool
 func (session *Session) Close() {
-	for _, v := range session.stmtCache {
-		v.Close()
-	}
-
 	if session.Db != nil {
 		//session.Engine.Pool.ReleaseDB(session.Engine, session.Db)
+		session.releaseTxConn()
 		session.Db = nil
 		session.Tx = nil
-		session.stmtCache = nil
 		session.Init()
 	}
 }
@@ -261,6 +284,16 @@ func (session *Session) NoCache() *Session {
 	return session
 }
 
+// CacheFor caches the results of the next Query, Q or Find for ttl. The
+// results are dropped early when the table of Find or one of tables is
+// written by Insert, Update or Delete, raw Exec doesn't drop them. It's
+// ignored in a transaction, whose reads could be rolled back.
+func (session *Session) CacheFor(ttl time.Duration, tables ...string) *Session {
+	session.Statement.cacheTTL = ttl
+	session.Statement.cacheTables = tables
+	return session
+}
+
 //The join_operator should be one of INNER, LEFT OUTER, CROSS etc - this will be prepended to JOIN
 func (session *Session) Join(join_operator, tablename, condition string) *Session {
 	session.Statement.Join(join_operator, tablename, condition)
@@ -286,12 +319,12 @@ func (session *Session) newDb() error {
 			return err
 		}*/
 		session.Db = session.Engine.db
-		session.stmtCache = make(map[uint32]*core.Stmt, 0)
 	}
 	return nil
 }
 
-// Begin a transaction
+// Begin a transaction, a Begin in an opened transaction begins a nested one
+// by a savepoint, which is ended by the next Commit or Rollback
 func (session *Session) Begin() error {
 	err := session.newDb()
 	if err != nil {
@@ -302,32 +335,53 @@ func (session *Session) Begin() error {
 		if err != nil {
 			return err
 		}
-		session.IsAutoCommit = false
-		session.IsCommitedOrRollbacked = false
-		session.Tx = tx
-
-		session.Engine.logSQL("BEGIN TRANSACTION")
+		session.startTx(tx)
+	} else if !session.IsCommitedOrRollbacked {
+		// nested transaction
+		return session.beginSavepoint()
 	}
 	return nil
 }
 
-// When using transaction, you can rollback if any error
+// When using transaction, you can rollback if any error. In a nested
+// transaction, only the changes since its Begin are rolled back.
 func (session *Session) Rollback() error {
 	if !session.IsAutoCommit && !session.IsCommitedOrRollbacked {
+		if len(session.savepoints) > 0 {
+			return session.rollbackSavepoint()
+		}
 		session.Engine.logSQL(session.Engine.dialect.RollBackStr())
 		session.IsCommitedOrRollbacked = true
-		return session.Tx.Rollback()
+		session.invalidations = nil
+		session.txTables = nil
+		err := session.Tx.Rollback()
+		session.releaseTxConn()
+		session.afterRollback()
+		return err
 	}
 	return nil
 }
 
-// When using transaction, Commit will commit all operations.
+// When using transaction, Commit will commit all operations. In a nested
+// transaction, the savepoint is released and the changes are committed by
+// the outermost Commit, which also runs the after processors. A failed
+// commit runs the OnRollback funcs and AfterRollback processors instead.
 func (session *Session) Commit() error {
 	if !session.IsAutoCommit && !session.IsCommitedOrRollbacked {
+		if len(session.savepoints) > 0 {
+			return session.commitSavepoint()
+		}
 		session.Engine.logSQL("COMMIT")
 		session.IsCommitedOrRollbacked = true
-		var err error
-		if err = session.Tx.Commit(); err == nil {
+		err := session.Engine.classifyError(session.Tx.Commit())
+		session.releaseTxConn()
+		if err == nil {
+			session.flushInvalidations()
+			for _, tableName := range session.txTables {
+				session.Engine.clearDependents(tableName)
+			}
+			session.txTables = nil
+
 			// handle processors after tx committed
 
 			closureCallFunc := func(closuresPtr *[]func(interface{}), bean interface{}) {
@@ -368,12 +422,40 @@ func (session *Session) Commit() error {
 			cleanUpFunc(&session.afterInsertBeans)
 			cleanUpFunc(&session.afterUpdateBeans)
 			cleanUpFunc(&session.afterDeleteBeans)
+
+			onCommit := session.onCommit
+			session.onCommit = nil
+			session.onRollback = nil
+			for _, fn := range onCommit {
+				fn()
+			}
+		} else {
+			// a failed commit is rolled back by the database
+			session.invalidations = nil
+			session.txTables = nil
+			session.afterRollback()
 		}
 		return err
 	}
 	return nil
 }
 
+// callSessionProcessor calls a processor which may run sql by the session,
+// on a new statement so the one of the running operation, whose maps would
+// be shared by a copy, is kept as it is. The session isn't closed by it.
+func (session *Session) callSessionProcessor(processor func(*Session) error) error {
+	statement := session.Statement
+	session.Statement = Statement{Engine: session.Engine}
+	session.Statement.Init()
+	isAutoClose := session.IsAutoClose
+	session.IsAutoClose = false
+	defer func() {
+		session.Statement = statement
+		session.IsAutoClose = isAutoClose
+	}()
+	return processor(session)
+}
+
 func cleanupProcessorsClosures(slices *[]func(interface{})) {
 	if len(*slices) > 0 {
 		*slices = make([]func(interface{}), 0)
@@ -390,6 +472,9 @@ func (session *Session) scanMapIntoStruct(obj interface{}, objMap map[string][]b
 	table := session.Engine.autoMapType(dataStruct)
 
 	for key, data := range objMap {
+		if isPagingColumn(key) {
+			continue
+		}
 		if col = table.GetColumn(key); col == nil {
 			session.Engine.LogWarn(fmt.Sprintf("struct %v's has not field %v. %v",
 				table.Type.Name(), key, table.ColumnsSeq()))
@@ -431,7 +516,7 @@ func (session *Session) innerExec(sqlStr string, args ...interface{}) (sql.Resul
 	if err != nil {
 		return nil, err
 	}
-	//defer stmt.Close()
+	defer session.releaseStmt(stmt)
 
 	res, err := stmt.Exec(args...)
 	if err != nil {
@@ -445,14 +530,19 @@ func (session *Session) exec(sqlStr string, args ...interface{}) (sql.Result, er
 		sqlStr = filter.Do(sqlStr, session.Engine.dialect, session.Statement.RefTable)
 	}
 
-	session.Engine.logSQL(sqlStr, args...)
+	session.logSQL(sqlStr, args)
 
-	return session.Engine.LogSQLExecutionTime(sqlStr, args, func() (sql.Result, error) {
-		if session.IsAutoCommit {
-			return session.innerExec(sqlStr, args...)
-		}
-		return session.Tx.Exec(sqlStr, args...)
-	})
+	var res sql.Result
+	hookCtx, err := session.beforeProcess(sqlStr, args, false)
+	if err == nil {
+		res, err = session.Engine.LogSQLExecutionTime(sqlStr, args, func() (sql.Result, error) {
+			if session.IsAutoCommit {
+				return session.innerExec(sqlStr, args...)
+			}
+			return session.Tx.Exec(sqlStr, args...)
+		})
+	}
+	return res, session.afterProcess(hookCtx, res, err)
 }
 
 // Exec raw sql
@@ -607,25 +697,56 @@ func (session *Session) DropTable(bean interface{}) error {
 	return err
 }
 
+// pkColumnsStr returns all the primary key columns joined by comma, with
+// table name if withTable is true
+func (statement *Statement) pkColumnsStr(withTable bool) string {
+	cols := make([]string, 0, len(statement.RefTable.PrimaryKeys))
+	for _, name := range statement.RefTable.PrimaryKeys {
+		if withTable {
+			cols = append(cols, statement.Engine.Quote(statement.TableName())+"."+statement.Engine.Quote(name))
+		} else {
+			cols = append(cols, statement.Engine.Quote(name))
+		}
+	}
+	return strings.Join(cols, ", ")
+}
+
 func (statement *Statement) convertIdSql(sqlStr string) string {
-	if statement.RefTable != nil {
-		col := statement.RefTable.PKColumns()[0]
-		if col != nil {
-			sqls := splitNNoCase(sqlStr, "from", 2)
-			if len(sqls) != 2 {
-				return ""
-			}
-			newsql := fmt.Sprintf("SELECT %v.%v FROM %v", statement.Engine.Quote(statement.TableName()),
-				statement.Engine.Quote(col.Name), sqls[1])
-			return newsql
+	if statement.RefTable != nil && len(statement.RefTable.PrimaryKeys) > 0 {
+		sqls := splitNNoCase(sqlStr, "from", 2)
+		if len(sqls) != 2 {
+			return ""
 		}
+		// a select paged by a PagingDialect may be wrapped in a derived
+		// table, whose columns have no table name
+		withTable := !strings.HasPrefix(strings.TrimSpace(sqls[1]), "(")
+		return fmt.Sprintf("SELECT %v%v FROM %v", selectTop(sqls[0]), statement.pkColumnsStr(withTable), sqls[1])
 	}
 	return ""
 }
 
+// pkOfRow builds the primary key of RefTable from a row queried by the sql
+// which convertIdSql or convertUpdateSql generated
+func (session *Session) pkOfRow(data map[string][]byte) (core.PK, error) {
+	table := session.Statement.RefTable
+	pk := make(core.PK, 0, len(table.PrimaryKeys))
+	for _, col := range table.PKColumns() {
+		v, ok := data[col.Name]
+		if !ok {
+			return nil, errors.New("no id")
+		}
+		id, err := pkOfBytes(table, col, v)
+		if err != nil {
+			return nil, err
+		}
+		pk = append(pk, id)
+	}
+	return pk, nil
+}
+
 func (session *Session) cacheGet(bean interface{}, sqlStr string, args ...interface{}) (has bool, err error) {
-	// if has no reftable or number of pks is not equal to 1, then don't use cache currently
-	if session.Statement.RefTable == nil || len(session.Statement.RefTable.PrimaryKeys) != 1 {
+	// if has no reftable or pks, then don't use cache currently
+	if session.Statement.RefTable == nil || len(session.Statement.RefTable.PrimaryKeys) == 0 {
 		return false, ErrCacheFailed
 	}
 	for _, filter := range session.Engine.dialect.Filters() {
@@ -641,31 +762,31 @@ func (session *Session) cacheGet(bean interface{}, sqlStr string, args ...interf
 	session.Engine.LogDebug("[xorm:cacheGet] find sql:", newsql, args)
 	ids, err := core.GetCacheSql(cacher, tableName, newsql, args)
 	if err != nil {
-		resultsSlice, err := session.query(newsql, args...)
-		if err != nil {
-			return false, err
-		}
-		session.Engine.LogDebug("[xorm:cacheGet] query ids:", resultsSlice)
-		ids = make([]core.PK, 0)
-		if len(resultsSlice) > 0 {
-			data := resultsSlice[0]
-			var id int64
-			if v, ok := data[session.Statement.RefTable.PrimaryKeys[0]]; !ok {
-				return false, ErrCacheFailed
-			} else {
-				// TODO https://github.com/go-xorm/xorm/issues/144, PK may not always be int64
-				id, err = strconv.ParseInt(string(v), 10, 64)
+		v, err := session.singleFlight("ids-"+genId(tableName, genSqlKey(newsql, args)), func() (interface{}, error) {
+			resultsSlice, err := session.query(newsql, args...)
+			if err != nil {
+				return nil, err
+			}
+			session.Engine.LogDebug("[xorm:cacheGet] query ids:", resultsSlice)
+			ids := make([]core.PK, 0)
+			if len(resultsSlice) > 0 {
+				id, err := session.pkOfRow(resultsSlice[0])
 				if err != nil {
-					return false, err
+					return nil, ErrCacheFailed
 				}
+				ids = append(ids, id)
 			}
-			ids = append(ids, core.PK{id})
-		}
-		session.Engine.LogDebug("[xorm:cacheGet] cache ids:", newsql, ids)
-		err = core.PutCacheSql(cacher, ids, tableName, newsql, args)
+			session.Engine.LogDebug("[xorm:cacheGet] cache ids:", newsql, ids)
+			if err := core.PutCacheSql(cacher, ids, tableName, newsql, args); err != nil {
+				return nil, err
+			}
+			session.putIdsDeps(cacher, tableName, newsql, args)
+			return ids, nil
+		})
 		if err != nil {
 			return false, err
 		}
+		ids = v.([]core.PK)
 	} else {
 		session.Engine.LogDebug("[xorm:cacheGet] cached sql:", newsql)
 	}
@@ -680,23 +801,32 @@ func (session *Session) cacheGet(bean interface{}, sqlStr string, args ...interf
 		}
 		cacheBean := cacher.GetBean(tableName, sid)
 		if cacheBean == nil {
-			newSession := session.Engine.NewSession()
-			defer newSession.Close()
-			cacheBean = reflect.New(structValue.Type()).Interface()
-			newSession.Id(id).NoCache()
-			if session.Statement.AltTableName != "" {
-				newSession.Table(session.Statement.AltTableName)
-			}
-			if !session.Statement.UseCascade {
-				newSession.NoCascade()
-			}
-			has, err = newSession.Get(cacheBean)
-			if err != nil || !has {
-				return has, err
-			}
+			key := fmt.Sprintf("bean-%v-%v-%v", structValue.Type(), session.Statement.UseCascade, genId(tableName, sid))
+			v, err := session.singleFlight(key, func() (interface{}, error) {
+				newSession := session.Engine.NewSession()
+				defer newSession.Close()
+				cacheBean := reflect.New(structValue.Type()).Interface()
+				newSession.Id(id).NoCache()
+				if session.Statement.AltTableName != "" {
+					newSession.Table(session.Statement.AltTableName)
+				}
+				if !session.Statement.UseCascade {
+					newSession.NoCascade()
+				}
+				has, err := newSession.Get(cacheBean)
+				if err != nil || !has {
+					return nil, err
+				}
 
-			session.Engine.LogDebug("[xorm:cacheGet] cache bean:", tableName, id, cacheBean)
-			cacher.PutBean(tableName, sid, cacheBean)
+				session.Engine.LogDebug("[xorm:cacheGet] cache bean:", tableName, id, cacheBean)
+				cacher.PutBean(tableName, sid, cacheBean)
+				return cacheBean, nil
+			})
+			if err != nil || v == nil {
+				return false, err
+			}
+			cacheBean = v
+			has = true
 		} else {
 			session.Engine.LogDebug("[xorm:cacheGet] cached bean:", tableName, id, cacheBean)
 			has = true
@@ -710,7 +840,7 @@ func (session *Session) cacheGet(bean interface{}, sqlStr string, args ...interf
 
 func (session *Session) cacheFind(t reflect.Type, sqlStr string, rowsSlicePtr interface{}, args ...interface{}) (err error) {
 	if session.Statement.RefTable == nil ||
-		len(session.Statement.RefTable.PrimaryKeys) != 1 ||
+		len(session.Statement.RefTable.PrimaryKeys) == 0 ||
 		indexNoCase(sqlStr, "having") != -1 ||
 		indexNoCase(sqlStr, "group by") != -1 {
 		return ErrCacheFailed
@@ -730,37 +860,39 @@ func (session *Session) cacheFind(t reflect.Type, sqlStr string, rowsSlicePtr in
 	ids, err := core.GetCacheSql(cacher, session.Statement.TableName(), newsql, args)
 	if err != nil {
 		//session.Engine.LogError(err)
-		resultsSlice, err := session.query(newsql, args...)
-		if err != nil {
-			return err
-		}
-		// æŸ¥è¯¢æ•°ç›®å¤ªå¤§ï¼Œé‡‡ç”¨ç¼“å­˜å°†ä¸æ˜¯ä¸€ä¸ªå¾ˆå¥½çš„æ–¹å¼ã€
-		if len(resultsSlice) > 500 {
-			session.Engine.LogDebug("[xorm:cacheFind] ids length %v > 500, no cache", len(resultsSlice))
-			return ErrCacheFailed
-		}
-
 		tableName := session.Statement.TableName()
-		ids = make([]core.PK, 0)
-		if len(resultsSlice) > 0 {
-			for _, data := range resultsSlice {
-				var id int64
-				if v, ok := data[session.Statement.RefTable.PrimaryKeys[0]]; !ok {
-					return errors.New("no id")
-				} else {
-					id, err = strconv.ParseInt(string(v), 10, 64)
+		v, err := session.singleFlight("ids-"+genId(tableName, genSqlKey(newsql, args)), func() (interface{}, error) {
+			resultsSlice, err := session.query(newsql, args...)
+			if err != nil {
+				return nil, err
+			}
+			// æŸ¥è¯¢æ•°ç›®å¤ªå¤§ï¼Œé‡‡ç”¨ç¼“å­˜å°†ä¸æ˜¯ä¸€ä¸ªå¾ˆå¥½çš„æ–¹å¼ã€
+			if len(resultsSlice) > 500 {
+				session.Engine.LogDebug("[xorm:cacheFind] ids length %v > 500, no cache", len(resultsSlice))
+				return nil, ErrCacheFailed
+			}
+
+			ids := make([]core.PK, 0)
+			if len(resultsSlice) > 0 {
+				for _, data := range resultsSlice {
+					id, err := session.pkOfRow(data)
 					if err != nil {
-						return err
+						return nil, err
 					}
+					ids = append(ids, id)
 				}
-				ids = append(ids, core.PK{id})
 			}
-		}
-		session.Engine.LogDebug("[xorm:cacheFind] cache ids:", ids, tableName, newsql, args)
-		err = core.PutCacheSql(cacher, ids, tableName, newsql, args)
+			session.Engine.LogDebug("[xorm:cacheFind] cache ids:", ids, tableName, newsql, args)
+			if err := core.PutCacheSql(cacher, ids, tableName, newsql, args); err != nil {
+				return nil, err
+			}
+			session.putIdsDeps(cacher, tableName, newsql, args)
+			return ids, nil
+		})
 		if err != nil {
 			return err
 		}
+		ids = v.([]core.PK)
 	} else {
 		session.Engine.LogDebug("[xorm:cacheFind] cached sql:", newsql, args)
 	}
@@ -768,7 +900,8 @@ func (session *Session) cacheFind(t reflect.Type, sqlStr string, rowsSlicePtr in
 	sliceValue := reflect.Indirect(reflect.ValueOf(rowsSlicePtr))
 	//pkFieldName := session.Statement.RefTable.PKColumns()[0].FieldName
 
-	ididxes := make(map[string]int)
+	// a joined query may return the same id more than once
+	ididxes := make(map[string][]int)
 	var ides []core.PK = make([]core.PK, 0)
 	var temps []interface{} = make([]interface{}, len(ids))
 	tableName := session.Statement.TableName()
@@ -777,10 +910,14 @@ func (session *Session) cacheFind(t reflect.Type, sqlStr string, rowsSlicePtr in
 		if err != nil {
 			return err
 		}
+		if idxes, ok := ididxes[sid]; ok {
+			ididxes[sid] = append(idxes, idx)
+			continue
+		}
 		bean := cacher.GetBean(tableName, sid)
 		if bean == nil {
 			ides = append(ides, id)
-			ididxes[sid] = idx
+			ididxes[sid] = []int{idx}
 		} else {
 			session.Engine.LogDebug("[xorm:cacheFind] cached bean:", tableName, id, bean)
 
@@ -799,26 +936,66 @@ func (session *Session) cacheFind(t reflect.Type, sqlStr string, rowsSlicePtr in
 	}
 
 	if len(ides) > 0 {
-		newSession := session.Engine.NewSession()
-		defer newSession.Close()
-
-		slices := reflect.New(reflect.SliceOf(t))
-		beans := slices.Interface()
-		//beans := reflect.New(sliceValue.Type()).Interface()
-		//err = newSession.In("(id)", ides...).OrderBy(session.Statement.OrderStr).NoCache().Find(beans)
-		ff := make([][]interface{}, len(table.PrimaryKeys))
-		for i, _ := range table.PrimaryKeys {
-			ff[i] = make([]interface{}, 0)
-		}
+		sids := make([]string, 0, len(ides))
 		for _, ie := range ides {
-			for i, _ := range table.PrimaryKeys {
-				ff[i] = append(ff[i], ie[i])
-			}
+			sid, _ := ie.ToString()
+			sids = append(sids, sid)
 		}
-		for i, name := range table.PrimaryKeys {
-			newSession.In(name, ff[i]...)
-		}
-		err = newSession.NoCache().Find(beans)
+		key := fmt.Sprintf("beans-%v-%v-%v", t, tableName, strings.Join(sids, ","))
+		beans, err := session.singleFlight(key, func() (interface{}, error) {
+			newSession := session.Engine.NewSession()
+			defer newSession.Close()
+
+			slices := reflect.New(reflect.SliceOf(t))
+			beans := slices.Interface()
+			//beans := reflect.New(sliceValue.Type()).Interface()
+			//err = newSession.In("(id)", ides...).OrderBy(session.Statement.OrderStr).NoCache().Find(beans)
+			if len(table.PrimaryKeys) == 1 {
+				ff := make([]interface{}, 0, len(ides))
+				for _, ie := range ides {
+					ff = append(ff, ie[0])
+				}
+				newSession.In(table.PrimaryKeys[0], ff...)
+			} else {
+				// an IN of every column would match the cross product of
+				// the ids, so each id is matched by all its columns
+				andStr := " " + session.Engine.dialect.AndStr() + " "
+				orStr := " " + session.Engine.dialect.OrStr() + " "
+				colConds := make([]string, len(table.PrimaryKeys))
+				for i, name := range table.PrimaryKeys {
+					colConds[i] = session.Engine.Quote(name) + " = ?"
+				}
+				idCond := "(" + strings.Join(colConds, andStr) + ")"
+				conds := make([]string, 0, len(ides))
+				args := make([]interface{}, 0, len(ides)*len(table.PrimaryKeys))
+				for _, ie := range ides {
+					conds = append(conds, idCond)
+					args = append(args, ie...)
+				}
+				newSession.Where("("+strings.Join(conds, orStr)+")", args...)
+			}
+			err := newSession.NoCache().Find(beans)
+			if err != nil {
+				return nil, err
+			}
+
+			vs := reflect.Indirect(reflect.ValueOf(beans))
+			for i := 0; i < vs.Len(); i++ {
+				rv := vs.Index(i)
+				if rv.Kind() != reflect.Ptr {
+					rv = rv.Addr()
+				}
+				bean := rv.Interface()
+				id := session.Engine.IdOf(bean)
+				sid, err := id.ToString()
+				if err != nil {
+					return nil, err
+				}
+				session.Engine.LogDebug("[xorm:cacheFind] cache bean:", tableName, id, bean)
+				cacher.PutBean(tableName, sid, bean)
+			}
+			return beans, nil
+		})
 		if err != nil {
 			return err
 		}
@@ -835,18 +1012,17 @@ func (session *Session) cacheFind(t reflect.Type, sqlStr string, rowsSlicePtr in
 			if err != nil {
 				return err
 			}
-			//bean := vs.Index(i).Addr().Interface()
-			temps[ididxes[sid]] = bean
+			for _, idx := range ididxes[sid] {
+				temps[idx] = bean
+			}
 			//temps[idxes[i]] = bean
-			session.Engine.LogDebug("[xorm:cacheFind] cache bean:", tableName, id, bean)
-			cacher.PutBean(tableName, sid, bean)
 		}
 	}
 
 	for j := 0; j < len(temps); j++ {
 		bean := temps[j]
 		if bean == nil {
-			session.Engine.LogWarn("[xorm:cacheFind] cache no hit:", tableName, ides[j])
+			session.Engine.LogWarn("[xorm:cacheFind] cache no hit:", tableName, ids[j])
 			// return errors.New("cache error") // !nashtsai! no need to return error, but continue instead
 			continue
 		}
@@ -862,16 +1038,17 @@ func (session *Session) cacheFind(t reflect.Type, sqlStr string, rowsSlicePtr in
 				key = ids[j]
 			}
 
+			ikey := reflect.ValueOf(int64(j))
 			if len(key) == 1 {
-				ikey, err := strconv.ParseInt(fmt.Sprintf("%v", key[0]), 10, 64)
+				ikey, err = mapKeyOf(key[0], sliceValue.Type().Key())
 				if err != nil {
 					return err
 				}
-				if t.Kind() == reflect.Ptr {
-					sliceValue.SetMapIndex(reflect.ValueOf(ikey), reflect.ValueOf(bean))
-				} else {
-					sliceValue.SetMapIndex(reflect.ValueOf(ikey), reflect.Indirect(reflect.ValueOf(bean)))
-				}
+			}
+			if t.Kind() == reflect.Ptr {
+				sliceValue.SetMapIndex(ikey, reflect.ValueOf(bean))
+			} else {
+				sliceValue.SetMapIndex(ikey, reflect.Indirect(reflect.ValueOf(bean)))
 			}
 		}
 		/*} else {
@@ -921,19 +1098,24 @@ func (session *Session) Iterate(bean interface{}, fun IterFunc) error {
 	return err
 }
 
-func (session *Session) doPrepare(sqlStr string) (stmt *core.Stmt, err error) {
-	crc := crc32.ChecksumIEEE([]byte(sqlStr))
-	// TODO try hash(sqlStr+len(sqlStr))
-	var has bool
-	stmt, has = session.stmtCache[crc]
-	if !has {
-		stmt, err = session.Db.Prepare(sqlStr)
-		if err != nil {
-			return nil, err
-		}
-		session.stmtCache[crc] = stmt
+// singleFlight coalesces the cache loadings of the same key from concurrent
+// sessions. Sessions in a transaction may see uncommitted data, so they load
+// by themselves.
+func (session *Session) singleFlight(key string, fn func() (interface{}, error)) (interface{}, error) {
+	if !session.IsAutoCommit {
+		return fn()
 	}
-	return
+	return session.Engine.cacheFlights.do(key, fn)
+}
+
+// doPrepare get a prepared statement from engine's statement cache, the
+// statement should be given back by releaseStmt after used
+func (session *Session) doPrepare(sqlStr string) (*core.Stmt, error) {
+	return session.Engine.stmtCache.acquire(sqlStr)
+}
+
+func (session *Session) releaseStmt(stmt *core.Stmt) {
+	session.Engine.stmtCache.release(stmt)
 }
 
 // get retrieve one record from database, bean's non-empty fields
@@ -964,37 +1146,42 @@ func (session *Session) Get(bean interface{}) (bool, error) {
 		args = session.Statement.RawParams
 	}
 
-	if session.Statement.JoinStr == "" {
-		if cacher := session.Engine.getCacher2(session.Statement.RefTable); cacher != nil && session.Statement.UseCache {
-			has, err := session.cacheGet(bean, sqlStr, args...)
-			if err != ErrCacheFailed {
-				return has, err
-			}
+	if cacher := session.Engine.getCacher2(session.Statement.RefTable); cacher != nil &&
+		session.Statement.UseCache &&
+		session.Statement.joinCacheable(cacher) {
+		has, err := session.cacheGet(bean, sqlStr, args...)
+		if err != ErrCacheFailed {
+			return has, session.sqlError(sqlStr, args, err)
 		}
 	}
 
 	var rawRows *core.Rows
 	session.queryPreprocess(&sqlStr, args...)
-	if session.IsAutoCommit {
-		stmt, err := session.doPrepare(sqlStr)
-		if err != nil {
-			return false, err
-		}
-		// defer stmt.Close() // !nashtsai! don't close due to stmt is cached and bounded to this session
-		rawRows, err = stmt.Query(args...)
-		if err != nil {
-			return false, err
+	var hookCtx *HookContext
+	hookCtx, err = session.beforeProcess(sqlStr, args, true)
+	if err == nil {
+		if session.IsAutoCommit {
+			var stmt *core.Stmt
+			stmt, err = session.doPrepare(sqlStr)
+			if err == nil {
+				defer session.releaseStmt(stmt)
+				rawRows, err = stmt.Query(args...)
+			}
+		} else {
+			rawRows, err = session.Tx.Query(sqlStr, args...)
 		}
-	} else {
-		rawRows, err = session.Tx.Query(sqlStr, args...)
 	}
-	if err != nil {
+	if err = session.afterProcess(hookCtx, nil, err); err != nil {
+		if rawRows != nil {
+			rawRows.Close()
+		}
 		return false, err
 	}
 
 	defer rawRows.Close()
 
 	if rawRows.Next() {
+		session.countRows(1)
 		if fields, err := rawRows.Columns(); err == nil {
 			err = session.row2Bean(rawRows, fields, len(fields), bean)
 		}
@@ -1045,8 +1232,8 @@ func (session *Session) Count(bean interface{}) (int64, error) {
 // Find retrieve records from table, condiBeans's non-empty fields
 // are conditions. beans could be []Struct, []*Struct, map[int64]Struct
 // map[int64]*Struct
-func (session *Session) Find(rowsSlicePtr interface{}, condiBean ...interface{}) error {
-	err := session.newDb()
+func (session *Session) Find(rowsSlicePtr interface{}, condiBean ...interface{}) (err error) {
+	err = session.newDb()
 	if err != nil {
 		return err
 	}
@@ -1107,27 +1294,39 @@ func (session *Session) Find(rowsSlicePtr interface{}, condiBean ...interface{})
 
 		sqlStr = session.Statement.genSelectSql(columnStr)
 		args = append(session.Statement.Params, session.Statement.BeanArgs...)
-		// for mssql and use limit
-		qs := strings.Count(sqlStr, "?")
-		if len(args)*2 == qs {
-			args = append(args, args...)
-		}
 	} else {
 		sqlStr = session.Statement.RawSQL
 		args = session.Statement.RawParams
 	}
 
-	if session.Statement.JoinStr == "" {
-		if cacher := session.Engine.getCacher2(table); cacher != nil &&
-			session.Statement.UseCache &&
-			!session.Statement.IsDistinct {
-			err = session.cacheFind(sliceElementType, sqlStr, rowsSlicePtr, args...)
-			if err != ErrCacheFailed {
-				return err
+	if session.useQueryCache() {
+		key := fmt.Sprintf("find-%v-%v", sliceValue.Type(), genSqlKey(sqlStr, args))
+		if cached := session.Engine.queryCache.get(key); cached != nil {
+			appendFindResults(sliceValue, deepCopy(cached.(reflect.Value)))
+			return nil
+		}
+		ttl, tables := session.Statement.cacheTTL, session.queryCacheTables(table.Name)
+		var oldLen int
+		if sliceValue.Kind() == reflect.Slice {
+			oldLen = sliceValue.Len()
+		}
+		defer func() {
+			if err == nil {
+				session.Engine.queryCache.put(key, copyFindResults(sliceValue, oldLen), ttl, tables)
 			}
-			err = nil // !nashtsai! reset err to nil for ErrCacheFailed
-			session.Engine.LogWarn("Cache Find Failed")
+		}()
+	}
+
+	if cacher := session.Engine.getCacher2(table); cacher != nil &&
+		session.Statement.UseCache &&
+		!session.Statement.IsDistinct &&
+		session.Statement.joinCacheable(cacher) {
+		err = session.cacheFind(sliceElementType, sqlStr, rowsSlicePtr, args...)
+		if err != ErrCacheFailed {
+			return session.sqlError(sqlStr, args, err)
 		}
+		err = nil // !nashtsai! reset err to nil for ErrCacheFailed
+		session.Engine.LogWarn("Cache Find Failed")
 	}
 
 	if sliceValue.Kind() != reflect.Map {
@@ -1136,16 +1335,23 @@ func (session *Session) Find(rowsSlicePtr interface{}, condiBean ...interface{})
 
 		session.queryPreprocess(&sqlStr, args...)
 
-		if session.IsAutoCommit {
-			stmt, err = session.doPrepare(sqlStr)
-			if err != nil {
-				return err
+		var hookCtx *HookContext
+		hookCtx, err = session.beforeProcess(sqlStr, args, true)
+		if err == nil {
+			if session.IsAutoCommit {
+				stmt, err = session.doPrepare(sqlStr)
+				if err == nil {
+					defer session.releaseStmt(stmt)
+					rawRows, err = stmt.Query(args...)
+				}
+			} else {
+				rawRows, err = session.Tx.Query(sqlStr, args...)
 			}
-			rawRows, err = stmt.Query(args...)
-		} else {
-			rawRows, err = session.Tx.Query(sqlStr, args...)
 		}
-		if err != nil {
+		if err = session.afterProcess(hookCtx, nil, err); err != nil {
+			if rawRows != nil {
+				rawRows.Close()
+			}
 			return err
 		}
 		defer rawRows.Close()
@@ -1208,22 +1414,20 @@ func (session *Session) Find(rowsSlicePtr interface{}, condiBean ...interface{})
 			if err != nil {
 				return err
 			}
-			var key int64
+			var key reflect.Value
 			// if there is only one pk, we can put the id as map key.
-			// TODO: should know if the column is ints
 			if len(table.PrimaryKeys) == 1 {
-				x, err := strconv.ParseInt(string(results[table.PrimaryKeys[0]]), 10, 64)
+				key, err = mapKeyOf(string(results[table.PrimaryKeys[0]]), sliceValue.Type().Key())
 				if err != nil {
-					return errors.New("pk " + table.PrimaryKeys[0] + " as int64: " + err.Error())
+					return errors.New("pk " + table.PrimaryKeys[0] + " as map key: " + err.Error())
 				}
-				key = x
 			} else {
-				key = int64(i)
+				key = reflect.ValueOf(int64(i))
 			}
 			if sliceElementType.Kind() == reflect.Ptr {
-				sliceValue.SetMapIndex(reflect.ValueOf(key), reflect.ValueOf(newValue.Interface()))
+				sliceValue.SetMapIndex(key, reflect.ValueOf(newValue.Interface()))
 			} else {
-				sliceValue.SetMapIndex(reflect.ValueOf(key), reflect.Indirect(reflect.ValueOf(newValue.Interface())))
+				sliceValue.SetMapIndex(key, reflect.Indirect(reflect.ValueOf(newValue.Interface())))
 			}
 		}
 	}
@@ -1453,6 +1657,9 @@ func row2map(rows *core.Rows, fields []string) (resultsMap map[string][]byte, er
 }
 
 func (session *Session) getField(dataStruct *reflect.Value, key string, table *core.Table, idx int) *reflect.Value {
+	if isPagingColumn(key) {
+		return nil
+	}
 	var col *core.Column
 	if col = table.GetColumnIdx(key, idx); col == nil {
 		session.Engine.LogWarn(fmt.Sprintf("table %v's has not column %v. %v", table.Name, key, table.Columns()))
@@ -1479,7 +1686,12 @@ func (session *Session) rows2Beans(rows *core.Rows, fields []string, fieldsCount
 	table *core.Table, newElemFunc func() reflect.Value,
 	sliceValueSetFunc func(*reflect.Value)) error {
 
+	var scanned int
+	defer func() {
+		session.countRows(scanned)
+	}()
 	for rows.Next() {
+		scanned++
 		var newValue reflect.Value = newElemFunc()
 		bean := newValue.Interface()
 		dataStruct := rValue(bean)
@@ -1812,17 +2024,27 @@ func (session *Session) queryPreprocess(sqlStr *string, paramStr ...interface{})
 		*sqlStr = filter.Do(*sqlStr, session.Engine.dialect, session.Statement.RefTable)
 	}
 
-	session.Engine.logSQL(*sqlStr, paramStr...)
+	session.logSQL(*sqlStr, paramStr)
 }
 
 func (session *Session) query(sqlStr string, paramStr ...interface{}) (resultsSlice []map[string][]byte, err error) {
 
 	session.queryPreprocess(&sqlStr, paramStr...)
 
-	if session.IsAutoCommit {
-		return session.innerQuery(session.Db, sqlStr, paramStr...)
+	var hookCtx *HookContext
+	hookCtx, err = session.beforeProcess(sqlStr, paramStr, true)
+	if err == nil {
+		if session.IsAutoCommit {
+			resultsSlice, err = session.innerQuery(session.Db, sqlStr, paramStr...)
+		} else {
+			resultsSlice, err = session.txQuery(session.Tx, sqlStr, paramStr...)
+		}
+	}
+	if err = session.afterProcess(hookCtx, nil, err); err != nil {
+		return nil, err
 	}
-	return session.txQuery(session.Tx, sqlStr, paramStr...)
+	session.countRows(len(resultsSlice))
+	return resultsSlice, nil
 }
 
 func (session *Session) txQuery(tx *core.Tx, sqlStr string, params ...interface{}) (resultsSlice []map[string][]byte, err error) {
@@ -1869,6 +2091,19 @@ func (session *Session) Query(sqlStr string, paramStr ...interface{}) (resultsSl
 		defer session.Close()
 	}
 
+	if session.useQueryCache() {
+		key := "query-" + genSqlKey(sqlStr, paramStr)
+		if cached := session.Engine.queryCache.get(key); cached != nil {
+			return copyBytesMaps(cached.([]map[string][]byte)), nil
+		}
+		ttl, tables := session.Statement.cacheTTL, session.queryCacheTables("")
+		resultsSlice, err = session.query(sqlStr, paramStr...)
+		if err == nil {
+			session.Engine.queryCache.put(key, copyBytesMaps(resultsSlice), ttl, tables)
+		}
+		return resultsSlice, err
+	}
+
 	return session.query(sqlStr, paramStr...)
 }
 
@@ -1882,10 +2117,20 @@ func (session *Session) Query(sqlStr string, paramStr ...interface{}) (resultsSl
 func (session *Session) query2(sqlStr string, paramStr ...interface{}) (resultsSlice []map[string]string, err error) {
 	session.queryPreprocess(&sqlStr, paramStr...)
 
-	if session.IsAutoCommit {
-		return query2(session.Db, sqlStr, paramStr...)
+	var hookCtx *HookContext
+	hookCtx, err = session.beforeProcess(sqlStr, paramStr, true)
+	if err == nil {
+		if session.IsAutoCommit {
+			resultsSlice, err = query2(session.Db, sqlStr, paramStr...)
+		} else {
+			resultsSlice, err = txQuery2(session.Tx, sqlStr, paramStr...)
+		}
 	}
-	return txQuery2(session.Tx, sqlStr, paramStr...)
+	if err = session.afterProcess(hookCtx, nil, err); err != nil {
+		return nil, err
+	}
+	session.countRows(len(resultsSlice))
+	return resultsSlice, nil
 }
 
 func txQuery2(tx *core.Tx, sqlStr string, params ...interface{}) (resultsSlice []map[string]string, err error) {
@@ -1922,6 +2167,19 @@ func (session *Session) Q(sqlStr string, paramStr ...interface{}) (resultsSlice
 	if session.IsAutoClose {
 		defer session.Close()
 	}
+
+	if session.useQueryCache() {
+		key := "q-" + genSqlKey(sqlStr, paramStr)
+		if cached := session.Engine.queryCache.get(key); cached != nil {
+			return copyStringMaps(cached.([]map[string]string)), nil
+		}
+		ttl, tables := session.Statement.cacheTTL, session.queryCacheTables("")
+		resultsSlice, err = session.query2(sqlStr, paramStr...)
+		if err == nil {
+			session.Engine.queryCache.put(key, copyStringMaps(resultsSlice), ttl, tables)
+		}
+		return resultsSlice, err
+	}
 	return session.query2(sqlStr, paramStr...)
 }
 
@@ -2005,6 +2263,12 @@ func (session *Session) innerInsertMulti(rowsSlicePtr interface{}) (int64, error
 		if processor, ok := interface{}(elemValue).(BeforeInsertProcessor); ok {
 			processor.BeforeInsert()
 		}
+		if processor, ok := interface{}(elemValue).(BeforeInsertSessionProcessor); ok {
+			if err := session.callSessionProcessor(processor.BeforeInsert); err != nil {
+				return 0, err
+			}
+		}
+		session.beforeValidate(elemValue)
 		// --
 
 		if i == 0 {
@@ -2066,6 +2330,13 @@ func (session *Session) innerInsertMulti(rowsSlicePtr interface{}) (int64, error
 	}
 	cleanupProcessorsClosures(&session.beforeClosures)
 
+	validateCols := lowerColNames(colNames)
+	for i := 0; i < size; i++ {
+		if err := session.validate(table, sliceValue.Index(i).Interface(), validateCols); err != nil {
+			return 0, err
+		}
+	}
+
 	statement := fmt.Sprintf("INSERT INTO %v%v%v (%v%v%v) VALUES (%v)",
 		session.Engine.QuoteStr(),
 		session.Statement.TableName(),
@@ -2081,6 +2352,7 @@ func (session *Session) innerInsertMulti(rowsSlicePtr interface{}) (int64, error
 		return 0, err
 	}
 
+	session.invalidateDependents(session.Statement.TableName())
 	if cacher := session.Engine.getCacher2(table); cacher != nil && session.Statement.UseCache {
 		session.cacheInsert(session.Statement.TableName())
 	}
@@ -2098,6 +2370,7 @@ func (session *Session) innerInsertMulti(rowsSlicePtr interface{}) (int64, error
 				processor.AfterInsert()
 			}
 		} else {
+			session.markSavepointBean(elemValue)
 			if lenAfterClosures > 0 {
 				if value, has := session.afterInsertBeans[elemValue]; has && value != nil {
 					*value = append(*value, session.afterClosures...)
@@ -2108,7 +2381,7 @@ func (session *Session) innerInsertMulti(rowsSlicePtr interface{}) (int64, error
 				}
 
 			} else {
-				if _, ok := interface{}(elemValue).(AfterInsertProcessor); ok {
+				if hasAfterTxProcessor(elemValue, isAfterInsertProcessor) {
 					session.afterInsertBeans[elemValue] = nil
 				}
 			}
@@ -2745,12 +3018,21 @@ func (session *Session) innerInsert(bean interface{}) (int64, error) {
 	if processor, ok := interface{}(bean).(BeforeInsertProcessor); ok {
 		processor.BeforeInsert()
 	}
+	if processor, ok := interface{}(bean).(BeforeInsertSessionProcessor); ok {
+		if err := session.callSessionProcessor(processor.BeforeInsert); err != nil {
+			return 0, err
+		}
+	}
+	session.beforeValidate(bean)
 	// --
 
 	colNames, args, err := genCols(table, session, bean, false, false)
 	if err != nil {
 		return 0, err
 	}
+	if err = session.validate(table, bean, lowerColNames(colNames)); err != nil {
+		return 0, err
+	}
 
 	colPlaces := strings.Repeat("?, ", len(colNames))
 	colPlaces = colPlaces[0 : len(colPlaces)-2]
@@ -2774,6 +3056,7 @@ func (session *Session) innerInsert(bean interface{}) (int64, error) {
 				processor.AfterInsert()
 			}
 		} else {
+			session.markSavepointBean(bean)
 			lenAfterClosures := len(session.afterClosures)
 			if lenAfterClosures > 0 {
 				if value, has := session.afterInsertBeans[bean]; has && value != nil {
@@ -2785,7 +3068,7 @@ func (session *Session) innerInsert(bean interface{}) (int64, error) {
 				}
 
 			} else {
-				if _, ok := interface{}(bean).(AfterInsertProcessor); ok {
+				if hasAfterTxProcessor(bean, isAfterInsertProcessor) {
 					session.afterInsertBeans[bean] = nil
 				}
 			}
@@ -2804,6 +3087,7 @@ func (session *Session) innerInsert(bean interface{}) (int64, error) {
 			handleAfterInsertProcessorFunc(bean)
 		}
 
+		session.invalidateDependents(session.Statement.TableName())
 		if cacher := session.Engine.getCacher2(table); cacher != nil && session.Statement.UseCache {
 			session.cacheInsert(session.Statement.TableName())
 		}
@@ -2863,6 +3147,7 @@ func (session *Session) innerInsert(bean interface{}) (int64, error) {
 			handleAfterInsertProcessorFunc(bean)
 		}
 
+		session.invalidateDependents(session.Statement.TableName())
 		if cacher := session.Engine.getCacher2(table); cacher != nil && session.Statement.UseCache {
 			session.cacheInsert(session.Statement.TableName())
 		}
@@ -2931,14 +3216,14 @@ func (session *Session) InsertOne(bean interface{}) (int64, error) {
 }
 
 func (statement *Statement) convertUpdateSql(sqlStr string) (string, string) {
-	if statement.RefTable == nil || len(statement.RefTable.PrimaryKeys) != 1 {
+	if statement.RefTable == nil || len(statement.RefTable.PrimaryKeys) == 0 {
 		return "", ""
 	}
 	sqls := splitNNoCase(sqlStr, "where", 2)
 	if len(sqls) != 2 {
 		if len(sqls) == 1 {
 			return sqls[0], fmt.Sprintf("SELECT %v FROM %v",
-				statement.Engine.Quote(statement.RefTable.PrimaryKeys[0]),
+				statement.pkColumnsStr(false),
 				statement.Engine.Quote(statement.RefTable.Name))
 		}
 		return "", ""
@@ -2966,12 +3251,12 @@ func (statement *Statement) convertUpdateSql(sqlStr string) (string, string) {
 	}
 
 	return sqls[0], fmt.Sprintf("SELECT %v FROM %v WHERE %v",
-		statement.Engine.Quote(statement.RefTable.PrimaryKeys[0]), statement.Engine.Quote(statement.TableName()),
+		statement.pkColumnsStr(false), statement.Engine.Quote(statement.TableName()),
 		whereStr)
 }
 
 func (session *Session) cacheInsert(tables ...string) error {
-	if session.Statement.RefTable == nil || len(session.Statement.RefTable.PrimaryKeys) != 1 {
+	if session.Statement.RefTable == nil {
 		return ErrCacheFailed
 	}
 
@@ -2981,13 +3266,14 @@ func (session *Session) cacheInsert(tables ...string) error {
 	for _, t := range tables {
 		session.Engine.LogDebug("cache clear:", t)
 		cacher.ClearIds(t)
+		session.broadcastInvalidation(CacheInvalidation{Table: t})
 	}
 
 	return nil
 }
 
 func (session *Session) cacheUpdate(sqlStr string, args ...interface{}) error {
-	if session.Statement.RefTable == nil || len(session.Statement.RefTable.PrimaryKeys) != 1 {
+	if session.Statement.RefTable == nil || len(session.Statement.RefTable.PrimaryKeys) == 0 {
 		return ErrCacheFailed
 	}
 
@@ -3024,16 +3310,11 @@ func (session *Session) cacheUpdate(sqlStr string, args ...interface{}) error {
 		ids = make([]core.PK, 0)
 		if len(resultsSlice) > 0 {
 			for _, data := range resultsSlice {
-				var id int64
-				if v, ok := data[session.Statement.RefTable.PrimaryKeys[0]]; !ok {
-					return errors.New("no id")
-				} else {
-					id, err = strconv.ParseInt(string(v), 10, 64)
-					if err != nil {
-						return err
-					}
+				id, err := session.pkOfRow(data)
+				if err != nil {
+					return err
 				}
-				ids = append(ids, core.PK{id})
+				ids = append(ids, id)
 			}
 		}
 	} /*else {
@@ -3041,6 +3322,7 @@ func (session *Session) cacheUpdate(sqlStr string, args ...interface{}) error {
 	    cacher.DelIds(tableName, genSqlKey(newsql, args))
 	}*/
 
+	invalidations := make([]CacheInvalidation, 0, len(ids)+1)
 	for _, id := range ids {
 		sid, err := id.ToString()
 		if err != nil {
@@ -3090,10 +3372,12 @@ func (session *Session) cacheUpdate(sqlStr string, args ...interface{}) error {
 
 			session.Engine.LogDebug("[xorm:cacheUpdate] update cache", tableName, id, bean)
 			cacher.PutBean(tableName, sid, bean)
+			invalidations = append(invalidations, CacheInvalidation{Table: tableName, Id: sid})
 		}
 	}
 	session.Engine.LogDebug("[xorm:cacheUpdate] clear cached table sql:", tableName)
 	cacher.ClearIds(tableName)
+	session.broadcastInvalidation(append(invalidations, CacheInvalidation{Table: tableName})...)
 	return nil
 }
 
@@ -3127,6 +3411,12 @@ func (session *Session) Update(bean interface{}, condiBean ...interface{}) (int6
 	if processor, ok := interface{}(bean).(BeforeUpdateProcessor); ok {
 		processor.BeforeUpdate()
 	}
+	if processor, ok := interface{}(bean).(BeforeUpdateSessionProcessor); ok {
+		if err := session.callSessionProcessor(processor.BeforeUpdate); err != nil {
+			return 0, err
+		}
+	}
+	session.beforeValidate(bean)
 	// --
 
 	if t.Kind() == reflect.Struct {
@@ -3143,6 +3433,9 @@ func (session *Session) Update(bean interface{}, condiBean ...interface{}) (int6
 				return 0, err
 			}
 		}
+		if err = session.validate(table, bean, lowerColNames(colNames)); err != nil {
+			return 0, err
+		}
 	} else if t.Kind() == reflect.Map {
 		if session.Statement.RefTable == nil {
 			return 0, ErrTableNotFound
@@ -3269,10 +3562,13 @@ func (session *Session) Update(bean interface{}, condiBean ...interface{}) (int6
 		verValue.SetInt(verValue.Int() + 1)
 	}
 
+	session.invalidateDependents(session.Statement.TableName())
+
 	if cacher := session.Engine.getCacher2(table); cacher != nil && session.Statement.UseCache {
 		//session.cacheUpdate(sqlStr, args...)
 		cacher.ClearIds(session.Statement.TableName())
 		cacher.ClearBeans(session.Statement.TableName())
+		session.broadcastInvalidation(CacheInvalidation{Table: session.Statement.TableName(), AllBeans: true})
 	}
 
 	// handle after update processors
@@ -3285,6 +3581,7 @@ func (session *Session) Update(bean interface{}, condiBean ...interface{}) (int6
 			processor.AfterUpdate()
 		}
 	} else {
+		session.markSavepointBean(bean)
 		lenAfterClosures := len(session.afterClosures)
 		if lenAfterClosures > 0 {
 			if value, has := session.afterUpdateBeans[bean]; has && value != nil {
@@ -3296,7 +3593,7 @@ func (session *Session) Update(bean interface{}, condiBean ...interface{}) (int6
 			}
 
 		} else {
-			if _, ok := interface{}(bean).(AfterInsertProcessor); ok {
+			if hasAfterTxProcessor(bean, isAfterUpdateProcessor) {
 				session.afterUpdateBeans[bean] = nil
 			}
 		}
@@ -3307,9 +3604,11 @@ func (session *Session) Update(bean interface{}, condiBean ...interface{}) (int6
 	return res.RowsAffected()
 }
 
-func (session *Session) cacheDelete(sqlStr string, args ...interface{}) error {
-	if session.Statement.RefTable == nil || len(session.Statement.RefTable.PrimaryKeys) != 1 {
-		return ErrCacheFailed
+// cacheDelete deletes the cached beans matched by the delete sql, it returns
+// the invalidations to broadcast once the delete succeeded
+func (session *Session) cacheDelete(sqlStr string, args ...interface{}) ([]CacheInvalidation, error) {
+	if session.Statement.RefTable == nil || len(session.Statement.RefTable.PrimaryKeys) == 0 {
+		return nil, ErrCacheFailed
 	}
 
 	for _, filter := range session.Engine.dialect.Filters() {
@@ -3318,7 +3617,7 @@ func (session *Session) cacheDelete(sqlStr string, args ...interface{}) error {
 
 	newsql := session.Statement.convertIdSql(sqlStr)
 	if newsql == "" {
-		return ErrCacheFailed
+		return nil, ErrCacheFailed
 	}
 
 	cacher := session.Engine.getCacher2(session.Statement.RefTable)
@@ -3327,21 +3626,16 @@ func (session *Session) cacheDelete(sqlStr string, args ...interface{}) error {
 	if err != nil {
 		resultsSlice, err := session.query(newsql, args...)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		ids = make([]core.PK, 0)
 		if len(resultsSlice) > 0 {
 			for _, data := range resultsSlice {
-				var id int64
-				if v, ok := data[session.Statement.RefTable.PrimaryKeys[0]]; !ok {
-					return errors.New("no id")
-				} else {
-					id, err = strconv.ParseInt(string(v), 10, 64)
-					if err != nil {
-						return err
-					}
+				id, err := session.pkOfRow(data)
+				if err != nil {
+					return nil, err
 				}
-				ids = append(ids, core.PK{id})
+				ids = append(ids, id)
 			}
 		}
 	} /*else {
@@ -3349,17 +3643,20 @@ func (session *Session) cacheDelete(sqlStr string, args ...interface{}) error {
 	    cacher.DelIds(tableName, genSqlKey(newsql, args))
 	}*/
 
+	invalidations := make([]CacheInvalidation, 0, len(ids)+1)
 	for _, id := range ids {
 		session.Engine.LogDebug("[xorm:cacheDelete] delete cache obj", tableName, id)
 		sid, err := id.ToString()
 		if err != nil {
-			return err
+			return nil, err
 		}
 		cacher.DelBean(tableName, sid)
+		invalidations = append(invalidations, CacheInvalidation{Table: tableName, Id: sid})
 	}
 	session.Engine.LogDebug("[xorm:cacheDelete] clear cache table", tableName)
 	cacher.ClearIds(tableName)
-	return nil
+	invalidations = append(invalidations, CacheInvalidation{Table: tableName})
+	return invalidations, nil
 }
 
 // Delete records, bean's non-empty fields are conditions
@@ -3382,6 +3679,11 @@ func (session *Session) Delete(bean interface{}) (int64, error) {
 	if processor, ok := interface{}(bean).(BeforeDeleteProcessor); ok {
 		processor.BeforeDelete()
 	}
+	if processor, ok := interface{}(bean).(BeforeDeleteSessionProcessor); ok {
+		if err := session.callSessionProcessor(processor.BeforeDelete); err != nil {
+			return 0, err
+		}
+	}
 	// --
 
 	table := session.Engine.TableInfo(bean)
@@ -3419,14 +3721,17 @@ func (session *Session) Delete(bean interface{}) (int64, error) {
 
 	args = append(session.Statement.Params, args...)
 
+	var invalidations []CacheInvalidation
 	if cacher := session.Engine.getCacher2(session.Statement.RefTable); cacher != nil && session.Statement.UseCache {
-		session.cacheDelete(sqlStr, args...)
+		invalidations, _ = session.cacheDelete(sqlStr, args...)
 	}
 
 	res, err := session.exec(sqlStr, args...)
 	if err != nil {
 		return 0, err
 	}
+	session.broadcastInvalidation(invalidations...)
+	session.invalidateDependents(session.Statement.TableName())
 
 	// handle after delete processors
 	if session.IsAutoCommit {
@@ -3437,6 +3742,7 @@ func (session *Session) Delete(bean interface{}) (int64, error) {
 			processor.AfterDelete()
 		}
 	} else {
+		session.markSavepointBean(bean)
 		lenAfterClosures := len(session.afterClosures)
 		if lenAfterClosures > 0 {
 			if value, has := session.afterDeleteBeans[bean]; has && value != nil {
@@ -3448,7 +3754,7 @@ func (session *Session) Delete(bean interface{}) (int64, error) {
 			}
 
 		} else {
-			if _, ok := interface{}(bean).(AfterInsertProcessor); ok {
+			if hasAfterTxProcessor(bean, isAfterDeleteProcessor) {
 				session.afterDeleteBeans[bean] = nil
 			}
 		}
@@ -0,0 +1,63 @@
+package xorm
+
+import (
+	"database/sql/driver"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+type compositePkBean struct {
+	A    int64 `xorm:"pk"`
+	B    int64 `xorm:"pk"`
+	Name string
+}
+
+func TestCacheFindCompositePk(t *testing.T) {
+	engine, db := newTestEngine(t)
+	engine.MapCacher(&compositePkBean{}, NewLRUCacher(NewMemoryStore(), 100))
+
+	// every combination of a and b is a row, only (1, 2) and (2, 1) are found
+	var all [][]driver.Value
+	for a := int64(1); a <= 2; a++ {
+		for b := int64(1); b <= 2; b++ {
+			all = append(all, []driver.Value{a, b, "x"})
+		}
+	}
+	var beansQuery string
+	db.rows = func(query string, args []driver.Value) ([]string, [][]driver.Value) {
+		if !strings.Contains(query, "`name`") {
+			return []string{"a", "b"}, [][]driver.Value{{int64(1), int64(2)}, {int64(2), int64(1)}}
+		}
+		// the beans are queried by the pairs of args
+		beansQuery = query
+		var rows [][]driver.Value
+		for _, row := range all {
+			for i := 0; i+1 < len(args); i += 2 {
+				if row[0] == args[i] && row[1] == args[i+1] {
+					rows = append(rows, row)
+				}
+			}
+		}
+		return []string{"a", "b", "name"}, rows
+	}
+
+	var beans []compositePkBean
+	if err := engine.Where("name = ?", "x").Find(&beans); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "WHERE ((`a` = ? AND `b` = ?) OR (`a` = ? AND `b` = ?))"
+	if !strings.Contains(beansQuery, want) {
+		t.Errorf("beans queried by %q, want %q", beansQuery, want)
+	}
+	var ids [][2]int64
+	for _, bean := range beans {
+		ids = append(ids, [2]int64{bean.A, bean.B})
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i][0] < ids[j][0] })
+	if wantIds := [][2]int64{{1, 2}, {2, 1}}; !reflect.DeepEqual(ids, wantIds) {
+		t.Errorf("found %v, want %v", ids, wantIds)
+	}
+}
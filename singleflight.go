@@ -0,0 +1,48 @@
+package xorm
+
+import (
+	"sync"
+)
+
+// flightCall is an in-flight or completed flightGroup.do call
+type flightCall struct {
+	wg  sync.WaitGroup
+	val interface{}
+	err error
+}
+
+// flightGroup coalesces the concurrent calls with the same key into one, so
+// goroutines missing the cache at the same time only hit database once
+type flightGroup struct {
+	mutex sync.Mutex
+	calls map[string]*flightCall
+}
+
+// do executes fn and returns its results, a duplicate caller waits for the
+// original one to complete and receives the same results
+func (g *flightGroup) do(key string, fn func() (interface{}, error)) (interface{}, error) {
+	g.mutex.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*flightCall)
+	}
+	if c, ok := g.calls[key]; ok {
+		g.mutex.Unlock()
+		c.wg.Wait()
+		return c.val, c.err
+	}
+	// if fn panics, the waiters fallback to query database themselves
+	c := &flightCall{err: ErrCacheFailed}
+	c.wg.Add(1)
+	g.calls[key] = c
+	g.mutex.Unlock()
+
+	defer func() {
+		g.mutex.Lock()
+		delete(g.calls, key)
+		g.mutex.Unlock()
+		c.wg.Done()
+	}()
+
+	c.val, c.err = fn()
+	return c.val, c.err
+}
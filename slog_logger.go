@@ -0,0 +1,135 @@
+//go:build go1.21
+// +build go1.21
+
+package xorm
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/go-xorm/core"
+)
+
+var _ core.ILogger = &SlogLogger{}
+var _ SQLLogSink = &SlogLogger{}
+
+// SlogLogger writes the engine's logs to a slog.Logger. As the engine's
+// Logger, it logs the executed sql as attributes after execution instead of
+// a text before, the slow ones at warning level.
+type SlogLogger struct {
+	logger *slog.Logger
+	level  core.LogLevel
+}
+
+func NewSlogLogger(logger *slog.Logger) *SlogLogger {
+	return NewSlogLogger2(logger, DEFAULT_LOG_LEVEL)
+}
+
+func NewSlogLogger2(logger *slog.Logger, l core.LogLevel) *SlogLogger {
+	return &SlogLogger{logger: logger, level: l}
+}
+
+// slogLevel maps a core.LogLevel to a slog.Level
+func slogLevel(l core.LogLevel) slog.Level {
+	switch l {
+	case core.LOG_ERR:
+		return slog.LevelError
+	case core.LOG_WARNING:
+		return slog.LevelWarn
+	case core.LOG_INFO:
+		return slog.LevelInfo
+	}
+	return slog.LevelDebug
+}
+
+func (s *SlogLogger) enabled(l core.LogLevel) bool {
+	return s.level > core.LOG_OFF && s.level >= l &&
+		s.logger.Enabled(context.Background(), slogLevel(l))
+}
+
+func (s *SlogLogger) log(l core.LogLevel, msg string, attrs ...slog.Attr) {
+	if s.enabled(l) {
+		s.logger.LogAttrs(context.Background(), slogLevel(l), msg, attrs...)
+	}
+}
+
+func (s *SlogLogger) Err(v ...interface{}) (err error) {
+	s.log(core.LOG_ERR, fmt.Sprint(v...))
+	return
+}
+
+func (s *SlogLogger) Errf(format string, v ...interface{}) (err error) {
+	s.log(core.LOG_ERR, fmt.Sprintf(format, v...))
+	return
+}
+
+func (s *SlogLogger) Debug(v ...interface{}) (err error) {
+	s.log(core.LOG_DEBUG, fmt.Sprint(v...))
+	return
+}
+
+func (s *SlogLogger) Debugf(format string, v ...interface{}) (err error) {
+	s.log(core.LOG_DEBUG, fmt.Sprintf(format, v...))
+	return
+}
+
+func (s *SlogLogger) Info(v ...interface{}) (err error) {
+	s.log(core.LOG_INFO, fmt.Sprint(v...))
+	return
+}
+
+func (s *SlogLogger) Infof(format string, v ...interface{}) (err error) {
+	s.log(core.LOG_INFO, fmt.Sprintf(format, v...))
+	return
+}
+
+func (s *SlogLogger) Warning(v ...interface{}) (err error) {
+	s.log(core.LOG_WARNING, fmt.Sprint(v...))
+	return
+}
+
+func (s *SlogLogger) Warningf(format string, v ...interface{}) (err error) {
+	s.log(core.LOG_WARNING, fmt.Sprintf(format, v...))
+	return
+}
+
+func (s *SlogLogger) Level() core.LogLevel {
+	return s.level
+}
+
+func (s *SlogLogger) SetLevel(l core.LogLevel) (err error) {
+	s.level = l
+	return
+}
+
+// LogSQL logs an executed sql at info level, or at warning level if it's slow
+func (s *SlogLogger) LogSQL(event *SQLLogEvent) {
+	l := core.LOG_INFO
+	if event.Slow {
+		l = core.LOG_WARNING
+	}
+	if !s.enabled(l) {
+		return
+	}
+
+	attrs := []slog.Attr{
+		slog.String("sql", event.SQL),
+		slog.Any("args", event.Args),
+		slog.Float64("duration_ms", float64(event.Duration.Nanoseconds())/1e6),
+		slog.String("table", event.Table),
+		slog.Int64("session_id", event.SessionId),
+		slog.Bool("in_transaction", event.InTransaction),
+	}
+	if event.RowsAffected >= 0 {
+		attrs = append(attrs, slog.Int64("rows_affected", event.RowsAffected))
+	}
+	if event.Err != nil {
+		attrs = append(attrs, slog.String("error", event.Err.Error()))
+	}
+	msg := "[sql]"
+	if event.Slow {
+		msg = "[sql] slow query"
+	}
+	s.log(l, msg, attrs...)
+}
@@ -0,0 +1,49 @@
+package xorm
+
+import (
+	"errors"
+	"fmt"
+)
+
+// SQLError is the error of a sql executed by a session, errors.Is and
+// errors.As see the wrapped error, which is the driver's error, classified
+// by the dialect, or an error of xorm
+type SQLError struct {
+	// Op is the sql verb, SELECT, INSERT, UPDATE, DELETE or OTHER
+	Op string
+	// Table is the table of the statement, empty for raw sql
+	Table string
+	SQL   string
+	// Args are redacted like the logged ones if the engine asks for
+	Args []interface{}
+	Err  error
+}
+
+func (e *SQLError) Error() string {
+	if e.Table == "" {
+		return fmt.Sprintf("%v failed: %v [sql] %v [args] %v", e.Op, e.Err, e.SQL, e.Args)
+	}
+	return fmt.Sprintf("%v on %v failed: %v [sql] %v [args] %v", e.Op, e.Table, e.Err, e.SQL, e.Args)
+}
+
+func (e *SQLError) Unwrap() error {
+	return e.Err
+}
+
+// sqlError wraps err with sqlStr and its args, unless it's already wrapped
+func (session *Session) sqlError(sqlStr string, args []interface{}, err error) error {
+	if err == nil {
+		return nil
+	}
+	var sqlErr *SQLError
+	if errors.As(err, &sqlErr) {
+		return err
+	}
+	return &SQLError{
+		Op:    sqlOp(sqlStr),
+		Table: session.Statement.TableName(),
+		SQL:   sqlStr,
+		Args:  session.logArgs(sqlStr, args),
+		Err:   err,
+	}
+}
@@ -0,0 +1,225 @@
+package xorm
+
+import (
+	"database/sql"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// SQLLogEvent is a SQL executed by a session
+type SQLLogEvent struct {
+	SQL  string
+	Args []interface{}
+	// Table is the table of the statement, empty for raw sql
+	Table    string
+	Duration time.Duration
+	// RowsAffected is the rows affected of an exec, -1 for a query
+	RowsAffected int64
+	Err          error
+	SessionId    int64
+	// InTransaction is true if the sql is executed in a transaction
+	InTransaction bool
+	// Slow is true if Duration exceeds the engine's slow query threshold
+	Slow bool
+}
+
+// SQLLogSink receives the SQL log events of an engine, it's called by the
+// executing session so it should return quickly
+type SQLLogSink interface {
+	LogSQL(event *SQLLogEvent)
+}
+
+// the last session id
+var sessionIds int64
+
+func nextSessionId() int64 {
+	return atomic.AddInt64(&sessionIds, 1)
+}
+
+// SetSQLLogSink set the sink receiving an event for every executed sql
+func (engine *Engine) SetSQLLogSink(sink SQLLogSink) {
+	engine.sqlLogSink = sink
+}
+
+// SetSlowQueryThreshold set the duration from which a sql is logged as a
+// warning, 0 disables the slow query log
+func (engine *Engine) SetSlowQueryThreshold(threshold time.Duration) {
+	engine.slowQueryThreshold = threshold
+}
+
+// SetRedactSensitiveArgs hides the args bound to the columns tagged
+// sensitive in the logged sql
+func (engine *Engine) SetRedactSensitiveArgs(redact bool) {
+	engine.redactSensitiveArgs = redact
+}
+
+// sensitiveColumns keeps the columns tagged sensitive of every table
+type sensitiveColumns struct {
+	mutex  sync.RWMutex
+	tables map[string]map[string]bool
+}
+
+func (s *sensitiveColumns) set(tableName string, colNames []string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.tables == nil {
+		s.tables = make(map[string]map[string]bool)
+	}
+	cols := make(map[string]bool, len(colNames))
+	for _, name := range colNames {
+		cols[strings.ToLower(name)] = true
+	}
+	s.tables[tableName] = cols
+}
+
+func (s *sensitiveColumns) of(tableName string) map[string]bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.tables[tableName]
+}
+
+// logArgs returns the args to log for sqlStr, the sensitive ones are
+// redacted if the engine asks for
+func (session *Session) logArgs(sqlStr string, args []interface{}) []interface{} {
+	if !session.Engine.redactSensitiveArgs || len(args) == 0 {
+		return args
+	}
+	sensitive := session.Engine.sensitiveCols.of(session.Statement.TableName())
+	if len(sensitive) == 0 {
+		return args
+	}
+	return redactArgs(sqlStr, args, sensitive)
+}
+
+// logSQL logs sqlStr as a text before executed, unless the engine's Logger
+// is a SQLLogSink, which logs the event after executed
+func (session *Session) logSQL(sqlStr string, args []interface{}) {
+	if _, ok := session.Engine.Logger.(SQLLogSink); ok {
+		return
+	}
+	session.Engine.logSQL(sqlStr, session.logArgs(sqlStr, args)...)
+}
+
+// logSQLEvent sends the event of sqlStr executed since start to the sink,
+// and logs it as a warning if it's slow. res is nil for a query.
+func (session *Session) logSQLEvent(sqlStr string, args []interface{}, start time.Time, res sql.Result, err error) {
+	engine := session.Engine
+	duration := time.Since(start)
+	slow := engine.slowQueryThreshold > 0 && duration >= engine.slowQueryThreshold
+	loggerSink, structured := engine.Logger.(SQLLogSink)
+	structured = structured && (engine.ShowSQL || slow)
+	if engine.sqlLogSink == nil && !slow && !structured {
+		return
+	}
+
+	event := &SQLLogEvent{
+		SQL:           sqlStr,
+		Args:          session.logArgs(sqlStr, args),
+		Table:         session.Statement.TableName(),
+		Duration:      duration,
+		RowsAffected:  -1,
+		Err:           err,
+		SessionId:     session.id,
+		InTransaction: !session.IsAutoCommit,
+		Slow:          slow,
+	}
+	if res != nil && err == nil {
+		if affected, err := res.RowsAffected(); err == nil {
+			event.RowsAffected = affected
+		}
+	}
+	if structured {
+		loggerSink.LogSQL(event)
+	} else if slow {
+		engine.Logger.Warningf("[sql] slow query took %v: %v [args] %v", duration, sqlStr, event.Args)
+	}
+	if engine.sqlLogSink != nil && (!structured || engine.sqlLogSink != loggerSink) {
+		engine.sqlLogSink.LogSQL(event)
+	}
+}
+
+const redactedArg = "***"
+
+var sqlPlaceholder = regexp.MustCompile(`\?|\$\d+|:\d+`)
+
+// redactArgs replaces the args bound to the sensitive columns by placeholder
+// position, the column of a placeholder is the one compared with or
+// assigned to it, or the one at the same position of an insert's columns
+func redactArgs(sqlStr string, args []interface{}, sensitive map[string]bool) []interface{} {
+	redacted := make([]interface{}, len(args))
+	copy(redacted, args)
+
+	trimmed := strings.TrimSpace(sqlStr)
+	if len(trimmed) >= 6 && strings.EqualFold(trimmed[:6], "INSERT") {
+		start := strings.Index(trimmed, "(")
+		end := strings.Index(trimmed, ")")
+		if start == -1 || end < start {
+			return redacted
+		}
+		cols := strings.Split(trimmed[start+1:end], ",")
+		for i := range redacted {
+			if sensitive[unquoteColumn(cols[i%len(cols)])] {
+				redacted[i] = redactedArg
+			}
+		}
+		return redacted
+	}
+
+	for n, loc := range sqlPlaceholder.FindAllStringIndex(sqlStr, -1) {
+		idx := n
+		if sqlStr[loc[0]] != '?' {
+			i, err := strconv.Atoi(sqlStr[loc[0]+1 : loc[1]])
+			if err != nil {
+				continue
+			}
+			idx = i - 1
+		}
+		if idx < 0 || idx >= len(redacted) {
+			continue
+		}
+		if sensitive[columnBefore(sqlStr[:loc[0]])] {
+			redacted[idx] = redactedArg
+		}
+	}
+	return redacted
+}
+
+var sqlOperators = []string{"<>", "!=", "<=", ">=", "=", "<", ">", " LIKE", " IN", " NOT"}
+
+// columnBefore returns the column compared with or assigned to a
+// placeholder preceded by prefix
+func columnBefore(prefix string) string {
+	s := strings.TrimSpace(prefix)
+	// skip the previous values of an IN list
+	if strings.HasSuffix(s, ",") {
+		if i := strings.LastIndex(s, "("); i != -1 {
+			s = strings.TrimSpace(s[:i])
+		}
+	}
+	s = strings.TrimSpace(strings.TrimSuffix(s, "("))
+	for trimmed := true; trimmed; {
+		trimmed = false
+		for _, op := range sqlOperators {
+			if len(s) >= len(op) && strings.EqualFold(s[len(s)-len(op):], op) {
+				s = strings.TrimSpace(s[:len(s)-len(op)])
+				trimmed = true
+			}
+		}
+	}
+	if i := strings.LastIndexAny(s, " ,("); i != -1 {
+		s = s[i+1:]
+	}
+	return unquoteColumn(s)
+}
+
+func unquoteColumn(name string) string {
+	name = strings.TrimSpace(name)
+	if i := strings.LastIndex(name, "."); i != -1 {
+		name = name[i+1:]
+	}
+	return strings.ToLower(strings.Trim(name, "`\"[]"))
+}
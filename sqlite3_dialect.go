@@ -402,3 +402,22 @@ func (db *sqlite3) GetIndexes(tableName string) (map[string]*core.Index, error)
 func (db *sqlite3) Filters() []core.Filter {
 	return []core.Filter{&core.IdFilter{}}
 }
+
+// sqlite3 reports every constraint failure by the same code, so they're
+// told by the messages
+func (db *sqlite3) ClassifyError(err error) error {
+	number, _ := driverErrorCode(err)
+	msg := errorMessage(err)
+	switch {
+	case strings.Contains(msg, "unique constraint failed"):
+		return ErrDuplicateKey
+	case strings.Contains(msg, "foreign key constraint failed"):
+		return ErrForeignKeyViolation
+	case strings.Contains(msg, "not null constraint failed"):
+		return ErrNotNullViolation
+	// SQLITE_BUSY, SQLITE_LOCKED, the lock was not got in the busy timeout
+	case number == 5 || number == 6 || strings.Contains(msg, "database is locked"):
+		return ErrLockTimeout
+	}
+	return nil
+}
@@ -61,6 +61,10 @@ type Statement struct {
 	inColumns     map[string]*inParam
 	incrColumns   map[string]incrParam
 	decrColumns   map[string]decrParam
+	cacheTTL      time.Duration
+	cacheTables   []string
+	joinTables    []string
+	noValidate    bool
 }
 
 // init
@@ -91,9 +95,13 @@ func (statement *Statement) Init() {
 	statement.useAllCols = false
 	statement.mustColumnMap = make(map[string]bool)
 	statement.checkVersion = true
+	statement.noValidate = false
 	statement.inColumns = make(map[string]*inParam)
 	statement.incrColumns = make(map[string]incrParam)
 	statement.decrColumns = make(map[string]decrParam)
+	statement.cacheTTL = 0
+	statement.cacheTables = nil
+	statement.joinTables = nil
 }
 
 // add the raw sql statement
@@ -904,6 +912,7 @@ func (statement *Statement) Asc(colNames ...string) *Statement {
 
 //The join_operator should be one of INNER, LEFT OUTER, CROSS etc - this will be prepended to JOIN
 func (statement *Statement) Join(join_operator, tablename, condition string) *Statement {
+	statement.joinTables = append(statement.joinTables, joinTableName(tablename))
 	if statement.JoinStr != "" {
 		statement.JoinStr = statement.JoinStr + fmt.Sprintf(" %v JOIN %v ON %v", join_operator,
 			statement.Engine.Quote(tablename), condition)
@@ -914,6 +923,32 @@ func (statement *Statement) Join(join_operator, tablename, condition string) *St
 	return statement
 }
 
+// joinTableName returns the bare name of a joined table, which may be quoted,
+// qualified by a schema and aliased like "`db`.`user` AS u"
+func joinTableName(tablename string) string {
+	tablename = strings.TrimSpace(tablename)
+	var quote byte
+	start, end := 0, len(tablename)
+	for i := 0; i < end; i++ {
+		c := tablename[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '`' || c == '"':
+			quote = c
+		case c == '[':
+			quote = ']'
+		case c == '.':
+			start = i + 1
+		case c == ' ' || c == '\t' || c == '\n':
+			end = i
+		}
+	}
+	return strings.Trim(tablename[start:end], "`\"[]")
+}
+
 // Generate "Group By keys" statement
 func (statement *Statement) GroupBy(keys string) *Statement {
 	statement.GroupByStr = keys
@@ -1100,12 +1135,6 @@ func (statement *Statement) genSelectSql(columnStr string) (a string) {
 		distinct = "DISTINCT "
 	}
 
-	var top string
-	var mssqlCondi string
-	var orderBy string
-	if statement.OrderStr != "" {
-		orderBy = fmt.Sprintf(" ORDER BY %v", statement.OrderStr)
-	}
 	statement.processIdParam()
 	var whereStr string
 	if statement.WhereStr != "" {
@@ -1122,38 +1151,16 @@ func (statement *Statement) genSelectSql(columnStr string) (a string) {
 		fromStr = fmt.Sprintf("%v %v", fromStr, statement.JoinStr)
 	}
 
-	if statement.Engine.dialect.DBType() == core.MSSQL {
-		if statement.LimitN > 0 {
-			top = fmt.Sprintf(" TOP %d ", statement.LimitN)
-		}
-		if statement.Start > 0 {
-			var column string = "(id)"
-			if len(statement.RefTable.PKColumns()) == 0 {
-				for _, index := range statement.RefTable.Indexes {
-					if len(index.Cols) == 1 {
-						column = index.Cols[0]
-						break
-					}
-				}
-				if len(column) == 0 {
-					column = statement.RefTable.ColumnsSeq()[0]
-				}
-			}
-			mssqlCondi = fmt.Sprintf("(%s NOT IN (SELECT TOP %d %s%s%s%s))",
-				column, statement.Start, column, fromStr, whereStr, orderBy)
-		}
+	pagingDialect, paging := statement.Engine.dialect.(PagingDialect)
+	paging = paging && (statement.LimitN > 0 || statement.Start > 0)
+	// the legacy paging numbers the rows in a derived table, which can't
+	// have a column twice like the * of the joined tables
+	if paging && statement.Engine.legacyPaging && statement.JoinStr != "" && columnStr == "*" {
+		columnStr = statement.Engine.Quote(statement.TableName()) + ".*"
 	}
 
 	// !nashtsai! REVIEW Sprintf is considered slowest mean of string concatnation, better to work with builder pattern
-	a = fmt.Sprintf("SELECT %v%v%v%v%v", top, distinct, columnStr,
-		fromStr, whereStr)
-	if mssqlCondi != "" {
-		if whereStr != "" {
-			a += " AND " + mssqlCondi
-		} else {
-			a += " WHERE " + mssqlCondi
-		}
-	}
+	a = fmt.Sprintf("SELECT %v%v%v%v", distinct, columnStr, fromStr, whereStr)
 
 	if statement.GroupByStr != "" {
 		a = fmt.Sprintf("%v GROUP BY %v", a, statement.GroupByStr)
@@ -1161,15 +1168,16 @@ func (statement *Statement) genSelectSql(columnStr string) (a string) {
 	if statement.HavingStr != "" {
 		a = fmt.Sprintf("%v %v", a, statement.HavingStr)
 	}
+	if paging {
+		return pagingDialect.PageSql(a, statement.OrderStr, statement.LimitN, statement.Start, statement.Engine.legacyPaging)
+	}
 	if statement.OrderStr != "" {
 		a = fmt.Sprintf("%v ORDER BY %v", a, statement.OrderStr)
 	}
-	if statement.Engine.dialect.DBType() != core.MSSQL {
-		if statement.Start > 0 {
-			a = fmt.Sprintf("%v LIMIT %v OFFSET %v", a, statement.LimitN, statement.Start)
-		} else if statement.LimitN > 0 {
-			a = fmt.Sprintf("%v LIMIT %v", a, statement.LimitN)
-		}
+	if statement.Start > 0 {
+		a = fmt.Sprintf("%v LIMIT %v OFFSET %v", a, statement.LimitN, statement.Start)
+	} else if statement.LimitN > 0 {
+		a = fmt.Sprintf("%v LIMIT %v", a, statement.LimitN)
 	}
 
 	return
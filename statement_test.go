@@ -0,0 +1,42 @@
+package xorm
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestJoinTableName(t *testing.T) {
+	var tests = []struct {
+		tablename, want string
+	}{
+		{"user", "user"},
+		{"`user`", "user"},
+		{"`user` u", "user"},
+		{"`user` AS u", "user"},
+		{`"public"."user" u`, "user"},
+		{"[dbo].[user] AS u", "user"},
+		{"db.user", "user"},
+		{"`user group` g", "user group"},
+		{" `user`\tu", "user"},
+	}
+
+	for _, test := range tests {
+		if got := joinTableName(test.tablename); got != test.want {
+			t.Errorf("%q: got %q, want %q", test.tablename, got, test.want)
+		}
+	}
+}
+
+func TestJoinAliasedTable(t *testing.T) {
+	engine, _ := newTestEngine(t)
+	session := engine.NewSession()
+	defer session.Close()
+
+	session.Join("INNER", "`user` u", "u.id = a.user_id").Join("LEFT", "`group`", "group.id = u.group_id")
+	if want := []string{"user", "group"}; !reflect.DeepEqual(session.Statement.joinTables, want) {
+		t.Errorf("joined tables %q, want %q", session.Statement.joinTables, want)
+	}
+	if want := "INNER JOIN `user` u ON u.id = a.user_id LEFT JOIN `group` ON group.id = u.group_id"; session.Statement.JoinStr != want {
+		t.Errorf("join %q, want %q", session.Statement.JoinStr, want)
+	}
+}
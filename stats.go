@@ -0,0 +1,210 @@
+package xorm
+
+import (
+	"database/sql"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// SQLStats counts the sql executed for an operation type or a table
+type SQLStats struct {
+	// Queries is the count of sql returning rows
+	Queries int64
+	Execs   int64
+	Errors  int64
+	// RowsScanned is the count of rows read from the query results
+	RowsScanned int64
+	Duration    time.Duration
+}
+
+// EngineStats is a snapshot of an engine's statistics
+type EngineStats struct {
+	// Ops is keyed by the sql verb, SELECT, INSERT, UPDATE, DELETE or OTHER
+	Ops    map[string]SQLStats
+	Tables map[string]SQLStats
+	// StmtCache counts the prepared statements reused
+	StmtCache StmtCacheStats
+	// Cache merges the statistics of the tables' LRUCachers
+	Cache map[string]CacheStats
+	DB    sql.DBStats
+}
+
+type sqlCounters struct {
+	queries     int64
+	execs       int64
+	errors      int64
+	rowsScanned int64
+	duration    int64
+}
+
+func (c *sqlCounters) add(query bool, err error, duration time.Duration) {
+	if query {
+		atomic.AddInt64(&c.queries, 1)
+	} else {
+		atomic.AddInt64(&c.execs, 1)
+	}
+	if err != nil {
+		atomic.AddInt64(&c.errors, 1)
+	}
+	atomic.AddInt64(&c.duration, int64(duration))
+}
+
+func (c *sqlCounters) snapshot() SQLStats {
+	return SQLStats{
+		Queries:     atomic.LoadInt64(&c.queries),
+		Execs:       atomic.LoadInt64(&c.execs),
+		Errors:      atomic.LoadInt64(&c.errors),
+		RowsScanned: atomic.LoadInt64(&c.rowsScanned),
+		Duration:    time.Duration(atomic.LoadInt64(&c.duration)),
+	}
+}
+
+// engineStats keeps the counters of an engine, the maps are only locked for
+// writing when a new operation type or table is met
+type engineStats struct {
+	mutex  sync.RWMutex
+	ops    map[string]*sqlCounters
+	tables map[string]*sqlCounters
+}
+
+func (s *engineStats) counters(ops bool, key string) *sqlCounters {
+	s.mutex.RLock()
+	m := s.tables
+	if ops {
+		m = s.ops
+	}
+	c, ok := m[key]
+	s.mutex.RUnlock()
+	if ok {
+		return c
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.ops == nil {
+		s.ops = make(map[string]*sqlCounters)
+		s.tables = make(map[string]*sqlCounters)
+	}
+	m = s.tables
+	if ops {
+		m = s.ops
+	}
+	if c, ok = m[key]; !ok {
+		c = &sqlCounters{}
+		m[key] = c
+	}
+	return c
+}
+
+func (s *engineStats) reset() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.ops = nil
+	s.tables = nil
+}
+
+// sqlOp returns the operation type of sqlStr
+func sqlOp(sqlStr string) string {
+	sqlStr = strings.TrimSpace(sqlStr)
+	if i := strings.IndexAny(sqlStr, " \t\n("); i != -1 {
+		sqlStr = sqlStr[:i]
+	}
+	op := strings.ToUpper(sqlStr)
+	switch op {
+	case "SELECT", "INSERT", "UPDATE", "DELETE":
+		return op
+	}
+	return "OTHER"
+}
+
+// countSQL counts a sql executed by the session, query is true if it
+// returns rows
+func (session *Session) countSQL(sqlStr string, query bool, err error, duration time.Duration) {
+	stats := &session.Engine.stats
+	session.lastOp = sqlOp(sqlStr)
+	session.lastTable = session.Statement.TableName()
+	stats.counters(true, session.lastOp).add(query, err, duration)
+	if session.lastTable != "" {
+		stats.counters(false, session.lastTable).add(query, err, duration)
+	}
+}
+
+// countRows counts the rows read from the result of the last sql
+func (session *Session) countRows(n int) {
+	if n <= 0 || session.lastOp == "" {
+		return
+	}
+	stats := &session.Engine.stats
+	atomic.AddInt64(&stats.counters(true, session.lastOp).rowsScanned, int64(n))
+	if session.lastTable != "" {
+		atomic.AddInt64(&stats.counters(false, session.lastTable).rowsScanned, int64(n))
+	}
+}
+
+// Stats returns the counters of the sql executed since the engine is
+// created or the stats are reset, the statement and cacher statistics
+func (engine *Engine) Stats() EngineStats {
+	stats := EngineStats{
+		Ops:       make(map[string]SQLStats),
+		Tables:    make(map[string]SQLStats),
+		StmtCache: engine.stmtCache.getStats(),
+		Cache:     make(map[string]CacheStats),
+		DB:        engine.db.Stats(),
+	}
+
+	engine.stats.mutex.RLock()
+	for op, c := range engine.stats.ops {
+		stats.Ops[op] = c.snapshot()
+	}
+	for tableName, c := range engine.stats.tables {
+		stats.Tables[tableName] = c.snapshot()
+	}
+	engine.stats.mutex.RUnlock()
+
+	for _, cacher := range engine.lruCachers() {
+		for tableName, s := range cacher.Stats().Tables {
+			total := stats.Cache[tableName]
+			total.Hits += s.Hits
+			total.Misses += s.Misses
+			total.Evictions += s.Evictions
+			total.Expirations += s.Expirations
+			stats.Cache[tableName] = total
+		}
+	}
+	return stats
+}
+
+// ResetStats clears the counters of the engine, its statement cache and
+// the tables' LRUCachers
+func (engine *Engine) ResetStats() {
+	engine.stats.reset()
+	engine.stmtCache.resetStats()
+	for _, cacher := range engine.lruCachers() {
+		cacher.ResetStats()
+	}
+}
+
+// lruCachers returns the distinct LRUCachers of the engine and its tables
+func (engine *Engine) lruCachers() []*LRUCacher {
+	cachers := make([]*LRUCacher, 0)
+	seen := make(map[*LRUCacher]bool)
+	add := func(cacher interface{}) {
+		if lru, ok := cacher.(*LRUCacher); ok && !seen[lru] {
+			seen[lru] = true
+			cachers = append(cachers, lru)
+		}
+	}
+	if engine.Cacher != nil {
+		add(engine.Cacher)
+	}
+	engine.mutex.RLock()
+	for _, table := range engine.Tables {
+		if table.Cacher != nil {
+			add(table.Cacher)
+		}
+	}
+	engine.mutex.RUnlock()
+	return cachers
+}
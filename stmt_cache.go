@@ -0,0 +1,160 @@
+package xorm
+
+import (
+	"container/list"
+	"sync"
+
+	"github.com/go-xorm/core"
+)
+
+const (
+	// default max prepared statements kept by an engine
+	DEFAULT_STMT_CACHE_SIZE = 500
+)
+
+// StmtCacheStats is a snapshot of the prepared statement cache counters
+type StmtCacheStats struct {
+	Hits      int64
+	Misses    int64
+	Evictions int64
+	Size      int
+}
+
+type stmtNode struct {
+	sql     string
+	stmt    *core.Stmt
+	refs    int
+	evicted bool
+}
+
+// stmtCache keeps the prepared statements of an engine's connection pool
+// in LRU order, keyed by the full sql text so different queries never share
+// a statement. A statement evicted while it is still used by a session is
+// closed when the last user releases it.
+type stmtCache struct {
+	db      *core.DB
+	mutex   sync.Mutex
+	list    *list.List
+	index   map[string]*list.Element
+	nodes   map[*core.Stmt]*stmtNode
+	maxSize int
+	stats   StmtCacheStats
+}
+
+func newStmtCache(db *core.DB, maxSize int) *stmtCache {
+	if maxSize < 0 {
+		maxSize = 0
+	}
+	return &stmtCache{
+		db:      db,
+		list:    list.New(),
+		index:   make(map[string]*list.Element),
+		nodes:   make(map[*core.Stmt]*stmtNode),
+		maxSize: maxSize,
+	}
+}
+
+// acquire returns a prepared statement for sqlStr, every successful acquire
+// should be followed by a release
+func (c *stmtCache) acquire(sqlStr string) (*core.Stmt, error) {
+	c.mutex.Lock()
+	if el, ok := c.index[sqlStr]; ok {
+		node := el.Value.(*stmtNode)
+		node.refs++
+		c.list.MoveToBack(el)
+		c.stats.Hits++
+		c.mutex.Unlock()
+		return node.stmt, nil
+	}
+	c.stats.Misses++
+	c.mutex.Unlock()
+
+	// prepare out of lock, so a slow prepare doesn't block other sessions
+	stmt, err := c.db.Prepare(sqlStr)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if el, ok := c.index[sqlStr]; ok {
+		// another session prepared the same sql meanwhile
+		stmt.Close()
+		node := el.Value.(*stmtNode)
+		node.refs++
+		c.list.MoveToBack(el)
+		return node.stmt, nil
+	}
+
+	node := &stmtNode{sql: sqlStr, stmt: stmt, refs: 1}
+	c.index[sqlStr] = c.list.PushBack(node)
+	c.nodes[stmt] = node
+	for c.list.Len() > c.maxSize {
+		c.evict(c.list.Front())
+	}
+	return stmt, nil
+}
+
+// release gives back a statement returned by acquire
+func (c *stmtCache) release(stmt *core.Stmt) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	node, ok := c.nodes[stmt]
+	if !ok {
+		return
+	}
+	node.refs--
+	if node.evicted && node.refs <= 0 {
+		delete(c.nodes, stmt)
+		stmt.Close()
+	}
+}
+
+// evict should be called with mutex locked
+func (c *stmtCache) evict(el *list.Element) {
+	node := el.Value.(*stmtNode)
+	c.list.Remove(el)
+	delete(c.index, node.sql)
+	node.evicted = true
+	c.stats.Evictions++
+	if node.refs <= 0 {
+		delete(c.nodes, node.stmt)
+		node.stmt.Close()
+	}
+}
+
+func (c *stmtCache) setMaxSize(maxSize int) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	// a size <= 0 disables the cache, statements are closed after used
+	if maxSize < 0 {
+		maxSize = 0
+	}
+	c.maxSize = maxSize
+	for c.list.Len() > c.maxSize {
+		c.evict(c.list.Front())
+	}
+}
+
+// clear evicts all statements, the ones in use are closed on release
+func (c *stmtCache) clear() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for c.list.Len() > 0 {
+		c.evict(c.list.Front())
+	}
+}
+
+func (c *stmtCache) resetStats() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.stats = StmtCacheStats{}
+}
+
+func (c *stmtCache) getStats() StmtCacheStats {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	stats := c.stats
+	stats.Size = c.list.Len()
+	return stats
+}
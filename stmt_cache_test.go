@@ -0,0 +1,140 @@
+package xorm
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/go-xorm/core"
+)
+
+// stmtDriver is a driver which only prepares and closes statements, and
+// counts the ones still open
+type stmtDriver struct {
+	mutex sync.Mutex
+	open  int
+}
+
+func (d *stmtDriver) Open(name string) (driver.Conn, error) {
+	return &stmtConn{d}, nil
+}
+
+func (d *stmtDriver) openStmts() int {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return d.open
+}
+
+type stmtConn struct {
+	driver *stmtDriver
+}
+
+func (c *stmtConn) Prepare(query string) (driver.Stmt, error) {
+	c.driver.mutex.Lock()
+	defer c.driver.mutex.Unlock()
+	c.driver.open++
+	return &stmtStmt{c.driver}, nil
+}
+
+func (c *stmtConn) Close() error { return nil }
+
+func (c *stmtConn) Begin() (driver.Tx, error) { return nil, errors.New("not supported") }
+
+type stmtStmt struct {
+	driver *stmtDriver
+}
+
+func (s *stmtStmt) Close() error {
+	s.driver.mutex.Lock()
+	defer s.driver.mutex.Unlock()
+	s.driver.open--
+	return nil
+}
+
+func (s *stmtStmt) NumInput() int { return -1 }
+
+func (s *stmtStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return nil, errors.New("not supported")
+}
+
+func (s *stmtStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return nil, errors.New("not supported")
+}
+
+var testStmtDriver = &stmtDriver{}
+
+func init() {
+	sql.Register("xorm_stmt_cache_test", testStmtDriver)
+}
+
+func newTestStmtCache(t *testing.T, maxSize int) *stmtCache {
+	db, err := core.Open("xorm_stmt_cache_test", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return newStmtCache(db, maxSize)
+}
+
+func TestStmtCacheSize(t *testing.T) {
+	var tests = []struct {
+		maxSize int
+		sqls    []string
+		stats   StmtCacheStats
+	}{
+		{-1, []string{"a", "a"}, StmtCacheStats{Misses: 2, Evictions: 2}},
+		{0, []string{"a", "b"}, StmtCacheStats{Misses: 2, Evictions: 2}},
+		{2, []string{"a", "b", "a", "c"}, StmtCacheStats{Hits: 1, Misses: 3, Evictions: 1, Size: 2}},
+		{2, []string{"a", "b", "c", "b", "a"}, StmtCacheStats{Hits: 1, Misses: 4, Evictions: 2, Size: 2}},
+	}
+
+	for _, test := range tests {
+		open := testStmtDriver.openStmts()
+		cache := newTestStmtCache(t, test.maxSize)
+		for _, sqlStr := range test.sqls {
+			stmt, err := cache.acquire(sqlStr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cache.release(stmt)
+		}
+		if stats := cache.getStats(); stats != test.stats {
+			t.Errorf("%d %v: stats %+v, want %+v", test.maxSize, test.sqls, stats, test.stats)
+		}
+		if n := testStmtDriver.openStmts() - open; n != test.stats.Size {
+			t.Errorf("%d %v: %d open statements, want %d", test.maxSize, test.sqls, n, test.stats.Size)
+		}
+		cache.clear()
+		cache.db.Close()
+	}
+}
+
+func TestStmtCacheEvictInUse(t *testing.T) {
+	open := testStmtDriver.openStmts()
+	cache := newTestStmtCache(t, 1)
+	defer cache.db.Close()
+	a, err := cache.acquire("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := cache.acquire("b")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a is evicted by b, but kept open until released
+	if n := testStmtDriver.openStmts() - open; n != 2 {
+		t.Errorf("%d open statements, want 2", n)
+	}
+	cache.release(a)
+	if n := testStmtDriver.openStmts() - open; n != 1 {
+		t.Errorf("%d open statements after release, want 1", n)
+	}
+
+	cache.setMaxSize(-1)
+	cache.release(b)
+	if n := testStmtDriver.openStmts() - open; n != 0 {
+		t.Errorf("%d open statements after setMaxSize(-1), want 0", n)
+	}
+}
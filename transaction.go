@@ -0,0 +1,103 @@
+package xorm
+
+import (
+	"errors"
+	"math/rand"
+	"time"
+)
+
+// TxRetryPolicy controls the retries of Engine.Transaction when a
+// transaction fails by a deadlock or a serialization failure
+type TxRetryPolicy struct {
+	// MaxRetries is the max times a transaction is retried, 0 disables retry
+	MaxRetries int
+	// Backoff is the wait before the first retry, doubled for every next one
+	Backoff time.Duration
+	// MaxBackoff, if > 0, is the max wait between two retries
+	MaxBackoff time.Duration
+}
+
+// SetTxRetryPolicy set the retry policy of Engine.Transaction
+func (engine *Engine) SetTxRetryPolicy(policy TxRetryPolicy) {
+	engine.txRetryPolicy = policy
+}
+
+// Transaction runs fn in a transaction, which is committed if fn returns nil
+// and rolled back if fn returns an error or panics, the panic is raised
+// again after rollback. The whole transaction is run again by the engine's
+// TxRetryPolicy if it fails by a deadlock or a serialization failure, so fn
+// should have no side effect out of the session.
+func (engine *Engine) Transaction(fn func(*Session) error) error {
+	policy := engine.txRetryPolicy
+	backoff := policy.Backoff
+	for retries := 0; ; retries++ {
+		err := engine.transaction(fn)
+		if err == nil || retries >= policy.MaxRetries || !engine.isRetryableTxError(err) {
+			return err
+		}
+
+		engine.LogWarn("[xorm:transaction] retry", retries+1, "after", err)
+		if backoff > 0 {
+			// jitter so the conflicting transactions don't retry together
+			time.Sleep(backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1)))
+			backoff *= 2
+			if policy.MaxBackoff > 0 && backoff > policy.MaxBackoff {
+				backoff = policy.MaxBackoff
+			}
+		}
+	}
+}
+
+func (engine *Engine) transaction(fn func(*Session) error) error {
+	session := engine.NewSession()
+	defer session.Close()
+	if err := session.Begin(); err != nil {
+		return err
+	}
+
+	committed := false
+	defer func() {
+		if committed {
+			return
+		}
+		if p := recover(); p != nil {
+			if err := session.rollbackAll(); err != nil {
+				engine.LogError("[xorm:transaction] rollback", err)
+			}
+			panic(p)
+		}
+	}()
+
+	if err := fn(session); err != nil {
+		if err := session.rollbackAll(); err != nil {
+			engine.LogError("[xorm:transaction] rollback", err)
+		}
+		return err
+	}
+	committed = true
+	return session.commitAll()
+}
+
+// rollbackAll rolls back the whole tx, even if fn left nested ones opened
+func (session *Session) rollbackAll() error {
+	session.savepoints = nil
+	return session.Rollback()
+}
+
+// commitAll commits the whole tx, the nested ones left opened by fn are
+// committed with it
+func (session *Session) commitAll() error {
+	if len(session.savepoints) > 0 {
+		session.Engine.LogWarn("[xorm:transaction]", len(session.savepoints), "nested transactions not ended")
+		session.savepoints = nil
+	}
+	return session.Commit()
+}
+
+// isRetryableTxError reports if err is a deadlock or a serialization
+// failure of the engine's database, a lock wait timeout is not retried as
+// the lock may still be held
+func (engine *Engine) isRetryableTxError(err error) bool {
+	err = engine.classifyError(err)
+	return errors.Is(err, ErrDeadlock) || errors.Is(err, ErrSerialization)
+}
@@ -0,0 +1,52 @@
+package xorm
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestTransactionNestedLeftOpen(t *testing.T) {
+	errFn := errors.New("fn failed")
+	var tests = []struct {
+		name string
+		err  error
+		fail bool
+		want []string
+	}{
+		{"commit", nil, false, []string{"BEGIN", "SAVEPOINT xorm_sp_1", "SAVEPOINT xorm_sp_2", "COMMIT"}},
+		{"rollback", errFn, false, []string{"BEGIN", "SAVEPOINT xorm_sp_1", "SAVEPOINT xorm_sp_2", "ROLLBACK"}},
+		{"panic", nil, true, []string{"BEGIN", "SAVEPOINT xorm_sp_1", "SAVEPOINT xorm_sp_2", "ROLLBACK"}},
+	}
+
+	for _, test := range tests {
+		engine, db := newTestEngine(t)
+		var err error
+		func() {
+			defer func() {
+				if p := recover(); (p != nil) != test.fail {
+					t.Errorf("%v: panic %v", test.name, p)
+				}
+			}()
+			err = engine.Transaction(func(session *Session) error {
+				// the nested transactions are never ended by fn
+				if err := session.Begin(); err != nil {
+					return err
+				}
+				if err := session.Begin(); err != nil {
+					return err
+				}
+				if test.fail {
+					panic("fn panics")
+				}
+				return test.err
+			})
+		}()
+		if err != test.err {
+			t.Errorf("%v: error %v, want %v", test.name, err, test.err)
+		}
+		if sqls := db.executed(); !reflect.DeepEqual(sqls, test.want) {
+			t.Errorf("%v: executed %q, want %q", test.name, sqls, test.want)
+		}
+	}
+}
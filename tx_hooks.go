@@ -0,0 +1,83 @@
+package xorm
+
+// OnCommit registers fn to be called after the session's transaction is
+// committed, fn is called at once if the session is not in a transaction.
+// The funcs registered in a nested transaction which is rolled back are
+// dropped.
+func (session *Session) OnCommit(fn func()) *Session {
+	if session.IsAutoCommit || session.IsCommitedOrRollbacked {
+		fn()
+		return session
+	}
+	session.onCommit = append(session.onCommit, fn)
+	return session
+}
+
+// OnRollback registers fn to be called after the session's transaction, or
+// the nested one it's registered in, is rolled back. It's ignored if the
+// session is not in a transaction.
+func (session *Session) OnRollback(fn func()) *Session {
+	if session.IsAutoCommit || session.IsCommitedOrRollbacked {
+		return session
+	}
+	session.onRollback = append(session.onRollback, fn)
+	return session
+}
+
+func isAfterInsertProcessor(bean interface{}) bool {
+	_, ok := bean.(AfterInsertProcessor)
+	return ok
+}
+
+func isAfterUpdateProcessor(bean interface{}) bool {
+	_, ok := bean.(AfterUpdateProcessor)
+	return ok
+}
+
+func isAfterDeleteProcessor(bean interface{}) bool {
+	_, ok := bean.(AfterDeleteProcessor)
+	return ok
+}
+
+// hasAfterTxProcessor reports if bean has to be kept until its transaction
+// ends, for the after processor checked by isProcessor or AfterRollback
+func hasAfterTxProcessor(bean interface{}, isProcessor func(interface{}) bool) bool {
+	if isProcessor(bean) {
+		return true
+	}
+	_, ok := bean.(AfterRollbackProcessor)
+	return ok
+}
+
+func callAfterRollback(beans map[interface{}]bool) {
+	for bean := range beans {
+		if processor, ok := bean.(AfterRollbackProcessor); ok {
+			processor.AfterRollback()
+		}
+	}
+}
+
+// afterRollback runs the AfterRollback processors of the beans written in
+// the rolled back transaction and the OnRollback funcs, the after processors
+// and OnCommit funcs are dropped
+func (session *Session) afterRollback() {
+	rolledBack := make(map[interface{}]bool)
+	for _, beans := range []map[interface{}]*[]func(interface{}){
+		session.afterInsertBeans, session.afterUpdateBeans, session.afterDeleteBeans,
+	} {
+		for bean := range beans {
+			rolledBack[bean] = true
+		}
+	}
+	session.afterInsertBeans = make(map[interface{}]*[]func(interface{}), 0)
+	session.afterUpdateBeans = make(map[interface{}]*[]func(interface{}), 0)
+	session.afterDeleteBeans = make(map[interface{}]*[]func(interface{}), 0)
+
+	onRollback := session.onRollback
+	session.onCommit = nil
+	session.onRollback = nil
+	callAfterRollback(rolledBack)
+	for _, fn := range onRollback {
+		fn()
+	}
+}
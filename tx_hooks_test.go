@@ -0,0 +1,47 @@
+package xorm
+
+import (
+	"errors"
+	"testing"
+)
+
+type txHookBean struct {
+	Id         int64
+	Name       string
+	rolledBack int `xorm:"-"`
+}
+
+func (bean *txHookBean) AfterRollback() {
+	bean.rolledBack++
+}
+
+func TestCommitFailedRunsRollbackHooks(t *testing.T) {
+	engine, db := newTestEngine(t)
+	session := engine.NewSession()
+	defer session.Close()
+
+	if err := session.Begin(); err != nil {
+		t.Fatal(err)
+	}
+	bean := &txHookBean{Name: "a"}
+	if _, err := session.Insert(bean); err != nil {
+		t.Fatal(err)
+	}
+	var committed, rolledBack int
+	session.OnCommit(func() { committed++ })
+	session.OnRollback(func() { rolledBack++ })
+
+	errCommit := errors.New("commit failed")
+	db.setErr("COMMIT", errCommit)
+	if err := session.Commit(); !errors.Is(err, errCommit) {
+		t.Fatalf("commit error %v, want %v", err, errCommit)
+	}
+	if committed != 0 || rolledBack != 1 || bean.rolledBack != 1 {
+		t.Errorf("OnCommit %d, OnRollback %d, AfterRollback %d times, want 0, 1, 1",
+			committed, rolledBack, bean.rolledBack)
+	}
+	if len(session.afterInsertBeans) != 0 || session.onCommit != nil || session.onRollback != nil ||
+		session.txTables != nil || session.invalidations != nil {
+		t.Error("the state of the failed tx is kept")
+	}
+}
@@ -0,0 +1,186 @@
+package xorm
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"strings"
+
+	"github.com/go-xorm/core"
+)
+
+// BeginTx begins a transaction with the isolation level and read-only mode
+// of opts, a nil opts is the same as Begin. When the driver doesn't support
+// the options, they are set by a SET TRANSACTION statement at the start of
+// the transaction if the database allows it. The options could not be set
+// on a nested transaction.
+func (session *Session) BeginTx(opts *sql.TxOptions) error {
+	if opts == nil {
+		return session.Begin()
+	}
+	err := session.newDb()
+	if err != nil {
+		return err
+	}
+	if !session.IsAutoCommit {
+		if !session.IsCommitedOrRollbacked {
+			return ErrNestedTxOptions
+		}
+		return nil
+	}
+
+	ctx := session.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	tx, err := session.Db.DB.BeginTx(ctx, opts)
+	if err != nil {
+		sqls, resetSqls, ok := session.setTransactionSqls(opts)
+		if !ok || !session.txOptionsUnsupported(ctx, opts, err) {
+			return err
+		}
+		session.Engine.LogDebug("[xorm:BeginTx] driver fallback:", err)
+
+		// the options lasting on the connection are reset on the same one
+		// before it goes back to the pool
+		if len(resetSqls) > 0 {
+			if session.txConn, err = session.Db.DB.Conn(ctx); err != nil {
+				return err
+			}
+			session.txResetSqls = resetSqls
+			tx, err = session.txConn.BeginTx(ctx, nil)
+		} else {
+			tx, err = session.Db.DB.BeginTx(ctx, nil)
+		}
+		if err != nil {
+			session.releaseTxConn()
+			return err
+		}
+		for _, sqlStr := range sqls {
+			session.Engine.logSQL(sqlStr)
+			if _, err = tx.Exec(sqlStr); err != nil {
+				tx.Rollback()
+				session.releaseTxConn()
+				return err
+			}
+		}
+	}
+
+	session.startTx(&core.Tx{Tx: tx, Mapper: session.Db.Mapper})
+	return nil
+}
+
+// txOptionsUnsupported reports if err, returned by BeginTx, is opts rejected
+// by database/sql since the driver doesn't take them, or by the driver
+func (session *Session) txOptionsUnsupported(ctx context.Context, opts *sql.TxOptions, err error) bool {
+	if opts.Isolation == sql.LevelDefault && !opts.ReadOnly {
+		return false
+	}
+	if conn, connErr := session.Db.DB.Conn(ctx); connErr == nil {
+		var takesOpts bool
+		connErr = conn.Raw(func(driverConn interface{}) error {
+			_, takesOpts = driverConn.(driver.ConnBeginTx)
+			return nil
+		})
+		conn.Close()
+		if connErr == nil && !takesOpts {
+			return true
+		}
+	}
+	// the drivers have no common error for the options they don't support
+	return strings.Contains(strings.ToLower(err.Error()), "not support")
+}
+
+// startTx sets the session in the just begun tx
+func (session *Session) startTx(tx *core.Tx) {
+	session.IsAutoCommit = false
+	session.IsCommitedOrRollbacked = false
+	session.Tx = tx
+	session.savepoints = nil
+	session.onCommit = nil
+	session.onRollback = nil
+
+	session.Engine.logSQL("BEGIN TRANSACTION")
+}
+
+// releaseTxConn restores the options set on the connection of the ended tx
+// and puts it back to the pool
+func (session *Session) releaseTxConn() {
+	if session.txConn == nil {
+		return
+	}
+	for _, sqlStr := range session.txResetSqls {
+		session.Engine.logSQL(sqlStr)
+		if _, err := session.txConn.ExecContext(context.Background(), sqlStr); err != nil {
+			session.Engine.LogError("[xorm:BeginTx] could not reset the connection:", err)
+		}
+	}
+	session.txConn.Close()
+	session.txConn = nil
+	session.txResetSqls = nil
+}
+
+var isolationLevelSqls = map[sql.IsolationLevel]string{
+	sql.LevelReadUncommitted: "READ UNCOMMITTED",
+	sql.LevelReadCommitted:   "READ COMMITTED",
+	sql.LevelRepeatableRead:  "REPEATABLE READ",
+	sql.LevelSerializable:    "SERIALIZABLE",
+	sql.LevelSnapshot:        "SNAPSHOT",
+}
+
+// setTransactionSqls returns the statements setting opts at the start of a
+// transaction of the engine's database, and the ones resetting the options
+// which outlast the transaction on its connection. ok is false if it's not
+// possible.
+func (session *Session) setTransactionSqls(opts *sql.TxOptions) (sqls, resetSqls []string, ok bool) {
+	level, hasLevel := isolationLevelSqls[opts.Isolation]
+	if opts.Isolation != sql.LevelDefault && !hasLevel {
+		return nil, nil, false
+	}
+
+	switch session.Engine.dialect.DBType() {
+	case core.POSTGRES:
+		if level == "SNAPSHOT" {
+			return nil, nil, false
+		}
+		modes := make([]string, 0, 2)
+		if hasLevel {
+			modes = append(modes, "ISOLATION LEVEL "+level)
+		}
+		if opts.ReadOnly {
+			modes = append(modes, "READ ONLY")
+		}
+		if len(modes) > 0 {
+			sqls = append(sqls, "SET TRANSACTION "+strings.Join(modes, ", "))
+		}
+		return sqls, nil, true
+	case core.MSSQL:
+		// no read-only transaction, the isolation level lasts on the
+		// connection until set again, so it's set back to the default
+		if opts.ReadOnly {
+			return nil, nil, false
+		}
+		if hasLevel {
+			sqls = append(sqls, "SET TRANSACTION ISOLATION LEVEL "+level)
+			resetSqls = append(resetSqls, "SET TRANSACTION ISOLATION LEVEL READ COMMITTED")
+		}
+		return sqls, resetSqls, true
+	case core.ORACLE:
+		// a read-only transaction has its own consistency, without level
+		if opts.ReadOnly {
+			if hasLevel && level != "SERIALIZABLE" {
+				return nil, nil, false
+			}
+			return []string{"SET TRANSACTION READ ONLY"}, nil, true
+		}
+		if level == "READ COMMITTED" || level == "SERIALIZABLE" {
+			return []string{"SET TRANSACTION ISOLATION LEVEL " + level}, nil, true
+		}
+		return nil, nil, !hasLevel
+	case core.SQLITE:
+		// transactions are always serializable
+		return nil, nil, !opts.ReadOnly && (!hasLevel || level == "SERIALIZABLE")
+	}
+	// mysql only allows SET TRANSACTION before the transaction starts
+	return nil, nil, false
+}
@@ -0,0 +1,88 @@
+package xorm
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/go-xorm/core"
+)
+
+// txOptsDriver opens the test connections taking the tx options, which
+// begin with optsErr when the options are not the default ones
+type txOptsDriver struct {
+	testDriver
+}
+
+var optsErr error
+
+type txOptsConn struct {
+	*testConn
+}
+
+func (d txOptsDriver) Open(dsn string) (driver.Conn, error) {
+	conn, err := d.testDriver.Open(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return txOptsConn{conn.(*testConn)}, nil
+}
+
+func (c txOptsConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if opts.Isolation != driver.IsolationLevel(sql.LevelDefault) || opts.ReadOnly {
+		return nil, optsErr
+	}
+	return c.Begin()
+}
+
+func init() {
+	sql.Register("xorm_test_tx_opts", txOptsDriver{})
+	core.RegisterDriver("xorm_test_tx_opts", txOptsDriver{})
+}
+
+func TestBeginTxFallback(t *testing.T) {
+	serializable := &sql.TxOptions{Isolation: sql.LevelSerializable}
+	readOnly := &sql.TxOptions{ReadOnly: true}
+	errUnsupported := errors.New("isolation level is not supported")
+	errConn := errors.New("connection refused")
+
+	var tests = []struct {
+		name    string
+		driver  string
+		optsErr error
+		opts    *sql.TxOptions
+		fails   bool
+	}{
+		// database/sql rejects the options of a driver not taking them
+		{"sql", "xorm_test", nil, serializable, false},
+		// sqlite3 could not set a read-only transaction
+		{"sql no fallback", "xorm_test", nil, readOnly, true},
+		{"driver", "xorm_test_tx_opts", errUnsupported, serializable, false},
+		{"driver error", "xorm_test_tx_opts", errConn, serializable, true},
+	}
+
+	for _, test := range tests {
+		optsErr = test.optsErr
+		engine, db := newTestEngineOf(t, test.driver)
+		session := engine.NewSession()
+		err := session.BeginTx(test.opts)
+		if (err != nil) != test.fails {
+			t.Errorf("%v: error %v", test.name, err)
+		}
+		if err == nil {
+			session.Rollback()
+		}
+		session.Close()
+
+		want := []string{"BEGIN", "ROLLBACK"}
+		if test.fails {
+			want = nil
+		}
+		if sqls := db.executed(); !reflect.DeepEqual(sqls, want) {
+			t.Errorf("%v: executed %q, want %q", test.name, sqls, want)
+		}
+	}
+}
@@ -0,0 +1,279 @@
+package xorm
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/go-xorm/core"
+)
+
+// FieldError is a field of a bean failing a validation rule
+type FieldError struct {
+	Field  string
+	Column string
+	// Rule is notnull, length, enum, set, min, max, regex or validate for
+	// the errors returned by the bean's Validate
+	Rule    string
+	Message string
+}
+
+func (e FieldError) Error() string {
+	if e.Field == "" {
+		return e.Message
+	}
+	return e.Field + ": " + e.Message
+}
+
+// ValidationError is returned by Insert and Update when the bean fails the
+// constraints declared by its tags or its Validate method, before any sql
+// is executed
+type ValidationError struct {
+	Table       string
+	FieldErrors []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.FieldErrors))
+	for i, fieldErr := range e.FieldErrors {
+		msgs[i] = fieldErr.Error()
+	}
+	return fmt.Sprintf("Validation of %v failed: %v", e.Table, strings.Join(msgs, "; "))
+}
+
+// Validator is implemented by the beans checking themselves before they're
+// inserted or updated, a returned *ValidationError adds its field errors
+type Validator interface {
+	Validate() error
+}
+
+// columnRule is the min(), max() and regex() tags of a column
+type columnRule struct {
+	min   *float64
+	max   *float64
+	regex *regexp.Regexp
+}
+
+// parseTag reads a min(), max() or regex() tag of a column
+func (rule *columnRule) parseTag(key string) error {
+	i := strings.Index(key, "(")
+	name, param := strings.ToUpper(key[:i]), key[i+1:len(key)-1]
+	if name == "REGEX" {
+		if len(param) >= 2 && param[0] == '\'' && param[len(param)-1] == '\'' {
+			param = param[1 : len(param)-1]
+		}
+		regex, err := regexp.Compile(param)
+		if err != nil {
+			return err
+		}
+		rule.regex = regex
+		return nil
+	}
+
+	bound, err := strconv.ParseFloat(param, 64)
+	if err != nil {
+		return err
+	}
+	if name == "MIN" {
+		rule.min = &bound
+	} else {
+		rule.max = &bound
+	}
+	return nil
+}
+
+func isValidationTag(k string) bool {
+	return strings.HasSuffix(k, ")") &&
+		(strings.HasPrefix(k, "MIN(") || strings.HasPrefix(k, "MAX(") || strings.HasPrefix(k, "REGEX("))
+}
+
+// joinRegexTags joins back the regex() tags split on the spaces of their
+// pattern, which should be quoted as regex('a b'). An unclosed tag is
+// dropped and reported by err, as is an unquoted pattern with spaces.
+func joinRegexTags(tags []string) (joined []string, err error) {
+	joined = make([]string, 0, len(tags))
+	for i := 0; i < len(tags); i++ {
+		tag := tags[i]
+		upper := strings.ToUpper(tag)
+		if strings.HasPrefix(upper, "REGEX(") {
+			end := ")"
+			if strings.HasPrefix(upper, "REGEX('") {
+				end = "')"
+			}
+			for !strings.HasSuffix(tag, end) && i+1 < len(tags) {
+				i++
+				tag += " " + tags[i]
+			}
+			if !strings.HasSuffix(tag, end) {
+				err = fmt.Errorf("unclosed tag %v", tag)
+				continue
+			}
+			if end == ")" && strings.Contains(tag, " ") {
+				err = fmt.Errorf("the pattern of %v has spaces and should be quoted as regex('...')", tag)
+			}
+		}
+		joined = append(joined, tag)
+	}
+	return joined, err
+}
+
+// columnRules keeps the validation tags of every table's columns
+type columnRules struct {
+	mutex  sync.RWMutex
+	tables map[string]map[string]*columnRule
+}
+
+func (r *columnRules) set(tableName string, rules map[string]*columnRule) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.tables == nil {
+		r.tables = make(map[string]map[string]*columnRule)
+	}
+	r.tables[tableName] = rules
+}
+
+func (r *columnRules) of(tableName string) map[string]*columnRule {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.tables[tableName]
+}
+
+// NoValidate skips the validation of the beans by the next Insert or Update
+func (session *Session) NoValidate() *Session {
+	session.Statement.noValidate = true
+	return session
+}
+
+// beforeValidate runs the BeforeValidate of bean, before the columns to
+// write are read from it
+func (session *Session) beforeValidate(bean interface{}) {
+	if processor, ok := bean.(BeforeValidateProcessor); ok && !session.Statement.noValidate {
+		processor.BeforeValidate()
+	}
+}
+
+// validate checks the columns of bean written to table, whose lower names
+// are in colNames, and runs the bean's Validate
+func (session *Session) validate(table *core.Table, bean interface{}, colNames map[string]bool) error {
+	if session.Statement.noValidate {
+		return nil
+	}
+
+	valErr := &ValidationError{Table: table.Name}
+	rules := session.Engine.validationRules.of(table.Name)
+	for _, col := range table.Columns() {
+		if !colNames[strings.ToLower(col.Name)] {
+			continue
+		}
+		fieldValue, err := col.ValueOf(bean)
+		if err != nil {
+			continue
+		}
+		if msg, rule := validateColumn(col, rules[col.Name], *fieldValue); rule != "" {
+			valErr.FieldErrors = append(valErr.FieldErrors, FieldError{
+				Field:   col.FieldName,
+				Column:  col.Name,
+				Rule:    rule,
+				Message: msg,
+			})
+		}
+	}
+
+	if validator, ok := bean.(Validator); ok {
+		if err := validator.Validate(); err != nil {
+			var beanErr *ValidationError
+			if errors.As(err, &beanErr) {
+				valErr.FieldErrors = append(valErr.FieldErrors, beanErr.FieldErrors...)
+			} else {
+				valErr.FieldErrors = append(valErr.FieldErrors, FieldError{Rule: "validate", Message: err.Error()})
+			}
+		}
+	}
+
+	if len(valErr.FieldErrors) > 0 {
+		return valErr
+	}
+	return nil
+}
+
+// validateColumn returns the message and the name of the first rule of col
+// failed by v, rule is "" if v is valid
+func validateColumn(col *core.Column, colRule *columnRule, v reflect.Value) (msg string, rule string) {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice:
+		if v.IsNil() {
+			if !col.Nullable && col.Default == "" && !col.IsAutoIncrement {
+				return "could not be null", "notnull"
+			}
+			return "", ""
+		}
+		if v.Kind() == reflect.Ptr {
+			v = v.Elem()
+		}
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		s := v.String()
+		switch col.SQLType.Name {
+		case core.Char, core.Varchar, core.NVarchar:
+			if col.Length > 0 && utf8.RuneCountInString(s) > col.Length {
+				return fmt.Sprintf("is longer than %d", col.Length), "length"
+			}
+		}
+		// an empty string leaves the enum or set unset
+		if len(col.EnumOptions) > 0 && s != "" {
+			if _, ok := col.EnumOptions[s]; !ok {
+				return fmt.Sprintf("%q is not an option", s), "enum"
+			}
+		}
+		if len(col.SetOptions) > 0 && s != "" {
+			for _, option := range strings.Split(s, ",") {
+				if _, ok := col.SetOptions[option]; !ok {
+					return fmt.Sprintf("%q is not an option", option), "set"
+				}
+			}
+		}
+		if colRule != nil && colRule.regex != nil && !colRule.regex.MatchString(s) {
+			return fmt.Sprintf("%q doesn't match %v", s, colRule.regex), "regex"
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return checkRange(colRule, float64(v.Int()))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return checkRange(colRule, float64(v.Uint()))
+	case reflect.Float32, reflect.Float64:
+		return checkRange(colRule, v.Float())
+	}
+	return "", ""
+}
+
+func checkRange(colRule *columnRule, f float64) (msg string, rule string) {
+	if colRule == nil {
+		return "", ""
+	}
+	if colRule.min != nil && f < *colRule.min {
+		return fmt.Sprintf("is less than %v", *colRule.min), "min"
+	}
+	if colRule.max != nil && f > *colRule.max {
+		return fmt.Sprintf("is greater than %v", *colRule.max), "max"
+	}
+	return "", ""
+}
+
+// lowerColNames returns the set of the lower names of an insert's columns,
+// or of an update's "column = ?" expressions
+func lowerColNames(colNames []string) map[string]bool {
+	names := make(map[string]bool, len(colNames))
+	for _, name := range colNames {
+		if i := strings.Index(name, "="); i != -1 {
+			name = name[:i]
+		}
+		names[unquoteColumn(name)] = true
+	}
+	return names
+}
@@ -0,0 +1,118 @@
+package xorm
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/go-xorm/core"
+)
+
+func newTestColumnRule(t *testing.T, tags ...string) *columnRule {
+	rule := &columnRule{}
+	for _, tag := range tags {
+		if err := rule.parseTag(tag); err != nil {
+			t.Fatal(tag, err)
+		}
+	}
+	return rule
+}
+
+func TestValidateColumn(t *testing.T) {
+	varchar := &core.Column{SQLType: core.SQLType{Name: core.Varchar}, Length: 3, Nullable: true}
+	notNull := &core.Column{SQLType: core.SQLType{Name: core.Varchar}}
+	enum := &core.Column{SQLType: core.SQLType{Name: core.Enum}, Nullable: true,
+		EnumOptions: map[string]int{"a": 0, "b": 1}}
+	set := &core.Column{SQLType: core.SQLType{Name: "SET"}, Nullable: true,
+		SetOptions: map[string]int{"a": 0, "b": 1}}
+	number := &core.Column{SQLType: core.SQLType{Name: core.Int}, Nullable: true}
+
+	rangeRule := newTestColumnRule(t, "min(1)", "max(10)")
+	regexRule := newTestColumnRule(t, "regex(^[a-z]+$)")
+	spaceRule := newTestColumnRule(t, "regex('^a b$')")
+
+	var nilStr *string
+	str := "abcd"
+
+	var tests = []struct {
+		col   *core.Column
+		rule  *columnRule
+		value interface{}
+		want  string
+	}{
+		{varchar, nil, "abc", ""},
+		{varchar, nil, "abcd", "length"},
+		{varchar, nil, "日本語", ""},
+		{varchar, nil, &str, "length"},
+		{varchar, nil, nilStr, ""},
+		{notNull, nil, nilStr, "notnull"},
+		{enum, nil, "a", ""},
+		{enum, nil, "", ""},
+		{enum, nil, "c", "enum"},
+		{set, nil, "a,b", ""},
+		{set, nil, "a,c", "set"},
+		{number, rangeRule, 1, ""},
+		{number, rangeRule, 0, "min"},
+		{number, rangeRule, uint(11), "max"},
+		{number, rangeRule, 10.5, "max"},
+		{number, nil, -1, ""},
+		{notNull, regexRule, "abc", ""},
+		{notNull, regexRule, "A1", "regex"},
+		{notNull, spaceRule, "a b", ""},
+		{notNull, spaceRule, "ab", "regex"},
+	}
+
+	for _, test := range tests {
+		msg, rule := validateColumn(test.col, test.rule, reflect.ValueOf(test.value))
+		if rule != test.want {
+			t.Errorf("%v %#v: rule %q (%v), want %q", test.col.SQLType.Name, test.value, rule, msg, test.want)
+		}
+	}
+}
+
+func TestJoinRegexTags(t *testing.T) {
+	var tests = []struct {
+		tag    string
+		joined []string
+		err    bool
+	}{
+		{"varchar(20) notnull", []string{"varchar(20)", "notnull"}, false},
+		{"regex(^[a-z]+$) notnull", []string{"regex(^[a-z]+$)", "notnull"}, false},
+		{"regex('^a  b$') notnull", []string{"regex('^a  b$')", "notnull"}, false},
+		{"regex(^a b$) notnull", []string{"regex(^a b$)", "notnull"}, true},
+		{"regex('^a b notnull", []string{}, true},
+	}
+
+	for _, test := range tests {
+		joined, err := joinRegexTags(strings.Split(test.tag, " "))
+		if !reflect.DeepEqual(joined, test.joined) || (err != nil) != test.err {
+			t.Errorf("%q: %q %v, want %q", test.tag, joined, err, test.joined)
+		}
+	}
+}
+
+type validatedBean struct {
+	err error
+}
+
+func (bean *validatedBean) Validate() error {
+	return bean.err
+}
+
+func TestValidateWrappedError(t *testing.T) {
+	session := &Session{Engine: &Engine{}}
+	table := &core.Table{Name: "bean"}
+
+	beanErr := &ValidationError{FieldErrors: []FieldError{{Field: "Name", Rule: "validate", Message: "taken"}}}
+	bean := &validatedBean{fmt.Errorf("checking: %w", beanErr)}
+	err := session.validate(table, bean, nil)
+	var valErr *ValidationError
+	if !errors.As(err, &valErr) {
+		t.Fatalf("%v is not a ValidationError", err)
+	}
+	if !reflect.DeepEqual(valErr.FieldErrors, beanErr.FieldErrors) {
+		t.Errorf("field errors %+v, want %+v", valErr.FieldErrors, beanErr.FieldErrors)
+	}
+}
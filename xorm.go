@@ -82,6 +82,8 @@ func NewEngine(driverName string, dataSourceName string) (*Engine, error) {
 		TagIdentifier: "xorm",
 		Logger:        NewSimpleLogger(os.Stdout),
 		TZLocation:    time.Local,
+		stmtCache:     newStmtCache(db, DEFAULT_STMT_CACHE_SIZE),
+		queryCache:    newQueryCache(DEFAULT_QUERY_CACHE_SIZE),
 	}
 
 	engine.SetMapper(core.NewCacheMapper(new(core.SnakeMapper)))
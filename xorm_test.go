@@ -0,0 +1,181 @@
+package xorm
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/go-xorm/core"
+)
+
+// testDB is the database of the test driver, which records the statements
+// and answers the queries by its rows func, so the engine's sqls are checked
+// without a real database
+type testDB struct {
+	mutex sync.Mutex
+	sqls  []string
+	args  [][]driver.Value
+	// errors of the statements starting by the keys, and of "COMMIT"
+	errs map[string]error
+	// rows returns the columns and rows of a query, none if nil
+	rows func(query string, args []driver.Value) ([]string, [][]driver.Value)
+}
+
+var (
+	testDBsMutex sync.Mutex
+	testDBs      = make(map[string]*testDB)
+)
+
+func (db *testDB) exec(query string, args []driver.Value) error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	db.sqls = append(db.sqls, query)
+	db.args = append(db.args, args)
+	for prefix, err := range db.errs {
+		if strings.HasPrefix(query, prefix) {
+			return err
+		}
+	}
+	return nil
+}
+
+// executed returns the recorded statements and clears them
+func (db *testDB) executed() []string {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	sqls := db.sqls
+	db.sqls, db.args = nil, nil
+	return sqls
+}
+
+func (db *testDB) setErr(prefix string, err error) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	db.errs[prefix] = err
+}
+
+type testDriver struct{}
+
+func (testDriver) Open(dsn string) (driver.Conn, error) {
+	testDBsMutex.Lock()
+	defer testDBsMutex.Unlock()
+	db, ok := testDBs[dsn]
+	if !ok {
+		return nil, fmt.Errorf("no test db %v", dsn)
+	}
+	return &testConn{db}, nil
+}
+
+func (testDriver) Parse(driverName, dataSourceName string) (*core.Uri, error) {
+	return &core.Uri{DbType: core.SQLITE, DbName: dataSourceName}, nil
+}
+
+type testConn struct {
+	db *testDB
+}
+
+func (c *testConn) Prepare(query string) (driver.Stmt, error) {
+	return &testStmt{c.db, query}, nil
+}
+
+func (c *testConn) Close() error { return nil }
+
+func (c *testConn) Begin() (driver.Tx, error) {
+	if err := c.db.exec("BEGIN", nil); err != nil {
+		return nil, err
+	}
+	return &testTx{c.db}, nil
+}
+
+type testTx struct {
+	db *testDB
+}
+
+func (tx *testTx) Commit() error { return tx.db.exec("COMMIT", nil) }
+
+func (tx *testTx) Rollback() error { return tx.db.exec("ROLLBACK", nil) }
+
+type testStmt struct {
+	db    *testDB
+	query string
+}
+
+func (s *testStmt) Close() error { return nil }
+
+func (s *testStmt) NumInput() int { return -1 }
+
+func (s *testStmt) Exec(args []driver.Value) (driver.Result, error) {
+	if err := s.db.exec(s.query, args); err != nil {
+		return nil, err
+	}
+	return testResult{}, nil
+}
+
+// testResult is the result of every exec, one row with the id 1
+type testResult struct{}
+
+func (testResult) LastInsertId() (int64, error) { return 1, nil }
+
+func (testResult) RowsAffected() (int64, error) { return 1, nil }
+
+func (s *testStmt) Query(args []driver.Value) (driver.Rows, error) {
+	if err := s.db.exec(s.query, args); err != nil {
+		return nil, err
+	}
+	rows := &testRows{}
+	if s.db.rows != nil {
+		rows.columns, rows.values = s.db.rows(s.query, args)
+	}
+	return rows, nil
+}
+
+type testRows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+func (r *testRows) Columns() []string { return r.columns }
+
+func (r *testRows) Close() error { return nil }
+
+func (r *testRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+func init() {
+	sql.Register("xorm_test", testDriver{})
+	regDrvsNDialects()
+	core.RegisterDriver("xorm_test", testDriver{})
+}
+
+// newTestEngine returns an engine of the sqlite3 dialect on a new testDB
+func newTestEngine(t *testing.T) (*Engine, *testDB) {
+	return newTestEngineOf(t, "xorm_test")
+}
+
+// newTestEngineOf returns an engine on a new testDB opened by driverName,
+// which wraps the test driver
+func newTestEngineOf(t *testing.T, driverName string) (*Engine, *testDB) {
+	db := &testDB{errs: make(map[string]error)}
+	testDBsMutex.Lock()
+	dsn := fmt.Sprintf("test%d", len(testDBs))
+	testDBs[dsn] = db
+	testDBsMutex.Unlock()
+
+	engine, err := NewEngine(driverName, dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	engine.Logger = NewSimpleLogger(ioutil.Discard)
+	return engine, db
+}